@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/spf13/cobra"
+)
+
+var checkCmd = &cobra.Command{
+	Use:   "check filename.smt...",
+	Short: "Check .smt files for syntax errors without running them",
+	Run:   execCheck,
+}
+
+func init() {
+	// Add the check command to the root command
+	rootCmd.AddCommand(checkCmd)
+	checkCmd.Flags().BoolP("color", "c", true, "Enable or disable colorized output")
+	checkCmd.Flags().StringP("format", "f", formatText, "Format of the errors: text or json, json writes a line for each file")
+}
+
+// execCheck parses the files and reports their diagnostics.
+// It exits with status 1 if any of the files has an error.
+func execCheck(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.Help()
+		return
+	}
+
+	ok := true
+	for _, file := range args {
+		if !strings.HasSuffix(file, ".smt") {
+			cmd.Println("Smarti can only check files that has Smarti's (.smt) extesion.")
+			return
+		}
+
+		out, err := newOutput(cmd, file, cmd.OutOrStdout())
+		if err != nil {
+			cmd.PrintErrln(err)
+			os.Exit(1)
+		}
+
+		lx := lexer.New(file)
+		if err := lx.Parse(); err != nil {
+			out.error(err)
+		} else {
+			parser := ast.NewParser(lx.Tokens)
+			_ = parser.Parse()
+			out.diagnostics(parser.Diagnostics)
+		}
+
+		out.flush()
+		ok = ok && out.OK
+	}
+
+	if !ok {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/fatih/color"
+	"github.com/spf13/cobra"
+)
+
+const (
+	formatText = "text"
+	formatJSON = "json"
+)
+
+// output reports the errors of a command. Text errors are printed right
+// away, JSON errors are collected and written as a single document by flush.
+type output struct {
+	w       io.Writer
+	json    bool
+	colored bool
+
+	File    string       `json:"file"`
+	OK      bool         `json:"ok"`
+	Reports []ast.Report `json:"diagnostics"`
+}
+
+func newOutput(cmd *cobra.Command, file string, w io.Writer) (*output, error) {
+	format := cmd.Flag("format").Value.String()
+	if format != formatText && format != formatJSON {
+		return nil, fmt.Errorf("unknown format '%s', expected %s or %s", format, formatText, formatJSON)
+	}
+
+	colored := !color.NoColor
+	if flag := cmd.Flag("color"); flag != nil && flag.Value.String() == "false" {
+		colored = false
+	}
+
+	return &output{
+		w:       w,
+		json:    format == formatJSON,
+		colored: colored,
+		File:    file,
+		OK:      true,
+		Reports: []ast.Report{},
+	}, nil
+}
+
+// diagnostics reports the errors and the warnings of the parser
+func (o *output) diagnostics(diags ast.Diagnostics) {
+	for _, d := range diags {
+		o.report(d.Report())
+	}
+}
+
+// error reports an error of the lexer or the runtime
+func (o *output) error(err error) {
+	for _, r := range ast.Reports(err) {
+		o.report(r)
+	}
+}
+
+func (o *output) report(r ast.Report) {
+	if r.Severity == ast.SeverityError {
+		o.OK = false
+	}
+
+	if o.json {
+		o.Reports = append(o.Reports, r)
+		return
+	}
+
+	fmt.Fprintln(o.w, r.Render(o.colored))
+}
+
+// flush writes the collected errors as a JSON object on a single line,
+// so the results of multiple files can be read line by line
+func (o *output) flush() {
+	if !o.json {
+		return
+	}
+
+	_ = json.NewEncoder(o.w).Encode(o)
+}
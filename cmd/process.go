@@ -19,6 +19,7 @@ func init() {
 	rootCmd.AddCommand(procCmd)
 	procCmd.Flags().BoolP("debug", "d", false, "Run the program in debug mode")
 	procCmd.Flags().BoolP("color", "c", true, "Enable or disable colorized output")
+	procCmd.Flags().StringP("format", "f", formatText, "Format of the errors: text or json, json is written to stderr")
 }
 
 func execProc(cmd *cobra.Command, args []string) {
@@ -32,13 +33,13 @@ func execProc(cmd *cobra.Command, args []string) {
 	f, err := os.Create(tmp)
 	if err != nil {
 		cmd.PrintErr(err)
-		return
+		os.Exit(1)
 	}
 
 	_, err = f.WriteString(code)
 	if err != nil {
 		cmd.PrintErr(err)
-		return
+		os.Exit(1)
 	}
 
 	execRun(cmd, []string{tmp})
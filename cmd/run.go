@@ -23,16 +23,16 @@ func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().BoolP("debug", "d", false, "Run the program in debug mode")
 	runCmd.Flags().BoolP("color", "c", true, "Enable or disable colorized output")
+	runCmd.Flags().StringP("format", "f", formatText, "Format of the errors: text or json, json is written to stderr")
 }
 
+// execRun runs the file and exits with status 1 if it has an error
 func execRun(cmd *cobra.Command, args []string) {
 	if len(args) == 0 {
 		cmd.Help()
 		return
 	}
 
-	debug := cmd.Flag("debug").Value.String() == "true"
-
 	for _, arg := range args {
 		if !strings.HasSuffix(arg, ".smt") {
 			cmd.Println("Smarti can only run files that has Smarti's (.smt) extesion.")
@@ -40,22 +40,42 @@ func execRun(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	if !runFile(cmd, args) {
+		os.Exit(1)
+	}
+}
+
+// runFile runs the first file, the rest of the files are passed to the lexer.
+// It reports whether the file ran without errors.
+func runFile(cmd *cobra.Command, args []string) bool {
+	debug := cmd.Flag("debug").Value.String() == "true"
+
+	out, err := newOutput(cmd, args[0], cmd.ErrOrStderr())
+	if err != nil {
+		cmd.PrintErrln(err)
+		return false
+	}
+	defer out.flush()
+
 	// Tokenize the source code with lexer
 	lx := lexer.New(args[0], args[1:]...)
 	if err := lx.Parse(); err != nil {
-		cmd.PrintErr(err)
-		return
+		out.error(err)
+		return false
 	}
 
 	if debug {
 		writeDebug("lexer.yaml", lx.Tokens)
 	}
 
-	// Generate abstract syntax tree from tokens
+	// Generate abstract syntax tree from tokens, every error
+	// and warning of the file is reported, not only the first one
 	parser := ast.NewParser(lx.Tokens)
-	if err := parser.Parse(); err != nil {
-		cmd.PrintErr(err)
-		return
+	err = parser.Parse()
+	out.diagnostics(parser.Diagnostics)
+
+	if err != nil {
+		return false
 	}
 
 	if debug {
@@ -65,9 +85,9 @@ func execRun(cmd *cobra.Command, args []string) {
 	// Interpret the nodes with runtime
 	runt := runtime.New()
 	if err := runt.Run(args[0], parser.Nodes); err != nil {
-		cmd.PrintErr(err)
-		return
+		out.error(err)
 	}
+	return out.OK
 }
 
 func writeDebug(file string, v any) {
@@ -0,0 +1,89 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic is a problem of the source code found by the parser
+type Diagnostic struct {
+	Severity Severity `json:"severity" yaml:"severity"`
+	Code     Err      `json:"code" yaml:"code"`
+	Message  string   `json:"message" yaml:"message"`
+	Span     Span     `json:"span" yaml:"span"`
+
+	err error
+}
+
+// NewDiagnostic creates a diagnostic from an error. The code is the
+// ast.Err the error wraps, the span is the position of an ErrWithPos.
+func NewDiagnostic(severity Severity, err error) Diagnostic {
+	d := Diagnostic{
+		Severity: severity,
+		Code:     ErrorInvalidSyntax,
+		err:      err,
+	}
+
+	var code Err
+	if errors.As(err, &code) {
+		d.Code = code
+	}
+
+	var posErr ErrWithPos
+	if errors.As(err, &posErr) {
+		d.Message = posErr.Err
+		d.Span = Span{Start: posErr.Pos, End: posErr.End}
+	} else {
+		d.Message = err.Error()
+	}
+
+	// The code is shown next to the message, e.g. error[unexpected token]: ...
+	d.Message = strings.TrimPrefix(d.Message, string(d.Code)+": ")
+	return d
+}
+
+func (d Diagnostic) Error() string {
+	return d.Render(!color.NoColor)
+}
+
+func (d Diagnostic) Unwrap() error {
+	return d.err
+}
+
+// Diagnostics is the list of the problems of a file
+type Diagnostics []Diagnostic
+
+// HasErrors reports whether any of the diagnostics is an error
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func (d Diagnostics) Error() string {
+	msgs := make([]string, len(d))
+	for i, diag := range d {
+		msgs[i] = diag.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (d Diagnostics) Unwrap() []error {
+	errs := make([]error, len(d))
+	for i, diag := range d {
+		errs[i] = diag
+	}
+	return errs
+}
@@ -4,19 +4,36 @@ import "github.com/fatih/color"
 
 type ErrWithPos struct {
 	Pos NodeFileInfo
+	// End is the position after the source code the error is about,
+	// it is the same as Pos if the range is unknown
+	End NodeFileInfo
 	Err string
+
+	err error
 }
 
 func NewErrWithPos(pos NodeFileInfo, err error) ErrWithPos {
 	return ErrWithPos{
 		Pos: pos,
+		End: pos,
 		Err: err.Error(),
+		err: err,
 	}
 }
 
+// NewErrWithSpan creates an error about a range of source code
+func NewErrWithSpan(span Span, err error) ErrWithPos {
+	e := NewErrWithPos(span.Start, err)
+	e.End = span.End
+	return e
+}
+
+func (l ErrWithPos) Unwrap() error {
+	return l.err
+}
+
 func (l ErrWithPos) Error() string {
-	red := color.New(color.FgRed, color.Bold).SprintFunc()
-	return red("Error: ") + l.Err + " at " + l.Pos.String()
+	return l.Render(!color.NoColor)
 }
 
 type Err string
@@ -47,6 +64,8 @@ const (
 	ErrorInvalidIndex        Err = "invalid index"
 	ErrorInvalidField        Err = "invalid field"
 	ErrorInvalidMethod       Err = "invalid method"
+	ErrorInvalidTemplate     Err = "invalid template"
+	ErrorUnreachableCode     Err = "unreachable code"
 )
 
 func (e Err) Error() string {
@@ -0,0 +1,138 @@
+package ast
+
+// Expr is a node of a typed expression tree
+type Expr interface {
+	Node
+	exprNode()
+}
+
+// LiteralExpr is a constant value like a number, a string or a template
+type LiteralExpr struct {
+	Type  NodeType     `json:"type" yaml:"type"`
+	Value string       `json:"value" yaml:"value"`
+	Info  NodeFileInfo `json:"info" yaml:"info"`
+	Span  Span         `json:"span" yaml:"span"`
+	// Template is the compiled template of a template literal
+	Template []TemplateNode `json:"template,omitempty" yaml:"template,omitempty"`
+}
+
+// IdentExpr is a reference to a variable
+type IdentExpr struct {
+	Name string       `json:"name" yaml:"name"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// MemberExpr accesses a named member of a value or a package: object.name
+type MemberExpr struct {
+	Object Expr         `json:"object" yaml:"object"`
+	Name   string       `json:"name" yaml:"name"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// CallExpr calls a function, a package function, a type method or a function value
+type CallExpr struct {
+	Callee Expr         `json:"callee" yaml:"callee"`
+	Args   []Expr       `json:"args,omitempty" yaml:"args,omitempty"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// IndexExpr accesses an item of a list, a map or a string: object[index]
+type IndexExpr struct {
+	Object Expr         `json:"object" yaml:"object"`
+	Index  Expr         `json:"index" yaml:"index"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// ListExpr is a list literal: [1, 2, 3]
+type ListExpr struct {
+	Items []Expr       `json:"items,omitempty" yaml:"items,omitempty"`
+	Info  NodeFileInfo `json:"info" yaml:"info"`
+	Span  Span         `json:"span" yaml:"span"`
+}
+
+// MapExpr is a map literal: {"key": value}
+type MapExpr struct {
+	Keys   []Expr       `json:"keys,omitempty" yaml:"keys,omitempty"`
+	Values []Expr       `json:"values,omitempty" yaml:"values,omitempty"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// UnaryExpr applies a prefix operator (-, !) to a single operand
+type UnaryExpr struct {
+	Operator string       `json:"operator" yaml:"operator"`
+	Operand  Expr         `json:"operand" yaml:"operand"`
+	Info     NodeFileInfo `json:"info" yaml:"info"`
+	Span     Span         `json:"span" yaml:"span"`
+}
+
+// BinaryExpr applies an infix operator to two operands
+type BinaryExpr struct {
+	Operator string       `json:"operator" yaml:"operator"`
+	Left     Expr         `json:"left" yaml:"left"`
+	Right    Expr         `json:"right" yaml:"right"`
+	Info     NodeFileInfo `json:"info" yaml:"info"`
+	Span     Span         `json:"span" yaml:"span"`
+}
+
+// FuncExpr is a function literal: func(x) { return x * 2; }
+// Its value is a closure of the scope it is evaluated in.
+type FuncExpr struct {
+	Params []*Param     `json:"params,omitempty" yaml:"params,omitempty"`
+	Body   *BlockStmt   `json:"body" yaml:"body"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+func (e *LiteralExpr) Pos() NodeFileInfo { return e.Info }
+func (e *IdentExpr) Pos() NodeFileInfo   { return e.Info }
+func (e *MemberExpr) Pos() NodeFileInfo  { return e.Info }
+func (e *CallExpr) Pos() NodeFileInfo    { return e.Info }
+func (e *IndexExpr) Pos() NodeFileInfo   { return e.Info }
+func (e *ListExpr) Pos() NodeFileInfo    { return e.Info }
+func (e *MapExpr) Pos() NodeFileInfo     { return e.Info }
+func (e *UnaryExpr) Pos() NodeFileInfo   { return e.Info }
+func (e *BinaryExpr) Pos() NodeFileInfo  { return e.Info }
+func (e *FuncExpr) Pos() NodeFileInfo    { return e.Info }
+
+func (e *LiteralExpr) Range() Span { return e.Span }
+func (e *IdentExpr) Range() Span   { return e.Span }
+func (e *MemberExpr) Range() Span  { return e.Span }
+func (e *CallExpr) Range() Span    { return e.Span }
+func (e *IndexExpr) Range() Span   { return e.Span }
+func (e *ListExpr) Range() Span    { return e.Span }
+func (e *MapExpr) Range() Span     { return e.Span }
+func (e *UnaryExpr) Range() Span   { return e.Span }
+func (e *BinaryExpr) Range() Span  { return e.Span }
+func (e *FuncExpr) Range() Span    { return e.Span }
+
+func (*LiteralExpr) exprNode() {}
+func (*IdentExpr) exprNode()   {}
+func (*MemberExpr) exprNode()  {}
+func (*CallExpr) exprNode()    {}
+func (*IndexExpr) exprNode()   {}
+func (*ListExpr) exprNode()    {}
+func (*MapExpr) exprNode()     {}
+func (*UnaryExpr) exprNode()   {}
+func (*BinaryExpr) exprNode()  {}
+func (*FuncExpr) exprNode()    {}
+
+// CalleeName returns the dotted name of a callee like `strs.trim`.
+// It reports false if the callee is not a chain of identifiers.
+func CalleeName(e Expr) (string, bool) {
+	switch e := e.(type) {
+	case *IdentExpr:
+		return e.Name, true
+	case *MemberExpr:
+		obj, ok := CalleeName(e.Object)
+		if !ok {
+			return "", false
+		}
+		return obj + "." + e.Name, true
+	}
+	return "", false
+}
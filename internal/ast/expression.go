@@ -0,0 +1,448 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+)
+
+// precedences holds the binding power of the binary operators.
+// Operators with a higher value bind tighter.
+var precedences = map[lexer.Token]int{
+	lexer.Or: 1,
+
+	lexer.And: 2,
+
+	lexer.Equal:    3,
+	lexer.NotEqual: 3,
+
+	lexer.LessThan:     4,
+	lexer.LessEqual:    4,
+	lexer.GreaterThan:  4,
+	lexer.GreaterEqual: 4,
+
+	lexer.Addition:    5,
+	lexer.Subtraction: 5,
+
+	lexer.Multiplication: 6,
+	lexer.Division:       6,
+	lexer.Modulo:         6,
+}
+
+// ParseExpression parses the tokens into a typed expression tree
+// with precedence climbing.
+func ParseExpression(tokens []lexer.LexerToken) (Expr, error) {
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("%w: empty expression", ErrorUnexpectedEOF)
+	}
+
+	p := NewParser(tokens)
+
+	expr, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	if !p.eof() {
+		return nil, unexpectedToken(p.peek())
+	}
+
+	return expr, nil
+}
+
+// ParseExpressionAt parses a piece of source code as an expression.
+// The positions of the tokens are shifted as if the source started at info,
+// e.g. at an interpolation inside of a template.
+func ParseExpressionAt(src string, info NodeFileInfo) (Expr, error) {
+	tokens, err := lexer.Tokenize(info.File, src)
+	if err != nil {
+		var lexErr *lexer.Error
+		if errors.As(err, &lexErr) {
+			line, pos := shiftPos(info, lexErr.Line, lexErr.Pos)
+			return nil, NewErrWithPos(NodeFileInfo{File: info.File, Line: line, Pos: pos}, fmt.Errorf("%w: %s", ErrorInvalidToken, lexErr.Msg))
+		}
+		return nil, NewErrWithPos(info, err)
+	}
+
+	for i := range tokens {
+		tokens[i].Info.Line, tokens[i].Info.Pos = shiftPos(info, tokens[i].Info.Line, tokens[i].Info.Pos)
+		tokens[i].Info.EndLine, tokens[i].Info.EndPos = shiftPos(info, tokens[i].Info.EndLine, tokens[i].Info.EndPos)
+	}
+
+	expr, err := ParseExpression(tokens)
+	if err != nil {
+		if _, ok := err.(ErrWithPos); !ok {
+			err = NewErrWithPos(info, err)
+		}
+		return nil, err
+	}
+
+	return expr, nil
+}
+
+// shiftPos moves a position of a piece of source code that starts at info
+func shiftPos(info NodeFileInfo, line, pos int) (int, int) {
+	if line == 1 {
+		pos += info.Pos - 1
+	}
+	return line + info.Line - 1, pos
+}
+
+// parseExpr parses an expression
+func (p *Parser) parseExpr() (Expr, error) {
+	return p.parseBinary(0)
+}
+
+func (p *Parser) parseBinary(minPrecedence int) (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for !p.eof() {
+		op := p.peek()
+
+		precedence, ok := precedences[op.Type]
+		if !ok || precedence <= minPrecedence {
+			break
+		}
+		p.inx++
+
+		right, err := p.parseBinary(precedence)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &BinaryExpr{
+			Operator: op.Value,
+			Left:     left,
+			Right:    right,
+			Info:     getInfo(op),
+			Span:     Span{Start: left.Range().Start, End: right.Range().End},
+		}
+	}
+
+	return left, nil
+}
+
+func (p *Parser) parseUnary() (Expr, error) {
+	tok, err := p.nextOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	if tok.Type == lexer.Subtraction || tok.Type == lexer.Not {
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		return &UnaryExpr{
+			Operator: tok.Value,
+			Operand:  operand,
+			Info:     getInfo(tok),
+			Span:     Span{Start: getInfo(tok), End: operand.Range().End},
+		}, nil
+	}
+
+	expr, err := p.parsePrimary(tok)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.parsePostfix(expr)
+}
+
+func (p *Parser) parsePrimary(tok lexer.LexerToken) (Expr, error) {
+	info, span := getInfo(tok), tokenSpan(tok)
+
+	switch tok.Type {
+	case lexer.ParantesisStart:
+		expr, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(lexer.ParantesisEnd); err != nil {
+			return nil, err
+		}
+
+		return expr, nil
+	case lexer.DoubleStringLiteral:
+		return &LiteralExpr{Type: VarString, Value: tok.Value, Info: info, Span: span}, nil
+	case lexer.SingleStringLiteral:
+		return &LiteralExpr{Type: VarSingleString, Value: tok.Value, Info: info, Span: span}, nil
+	case lexer.Template:
+		value := templateContent(tok)
+		info := templateInfo(tok)
+
+		template, err := ParseTemplate(value, info)
+		if err != nil {
+			return nil, err
+		}
+		return &LiteralExpr{Type: VarTemplate, Value: value, Info: info, Span: span, Template: template}, nil
+	case lexer.Nil:
+		return &LiteralExpr{Type: VarNil, Value: "nil", Info: info, Span: span}, nil
+	case lexer.Bool:
+		return &LiteralExpr{Type: VarBool, Value: tok.Value, Info: info, Span: span}, nil
+	case lexer.Number:
+		return parseNumber(tok)
+	case lexer.Identifier:
+		return &IdentExpr{Name: tok.Value, Info: info, Span: span}, nil
+	case lexer.BracketStart:
+		return p.parseList(tok)
+	case lexer.CurlyBraceStart:
+		return p.parseMap(tok)
+	case lexer.Func:
+		return p.parseFuncExpr(tok)
+	}
+
+	return nil, unexpectedToken(tok)
+}
+
+// parseFuncExpr parses a function literal after the func keyword: func(x) { return x * 2; }
+func (p *Parser) parseFuncExpr(start lexer.LexerToken) (Expr, error) {
+	params, err := p.parseParams("func", getInfo(start))
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseFuncBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FuncExpr{Params: params, Body: body, Info: getInfo(start), Span: p.spanFrom(getInfo(start))}, nil
+}
+
+// parsePostfix parses the calls, index and member accesses after an expression
+func (p *Parser) parsePostfix(expr Expr) (Expr, error) {
+	for !p.eof() {
+		tok := p.peek()
+		start := expr.Range().Start
+
+		switch tok.Type {
+		case lexer.ParantesisStart:
+			p.inx++
+
+			switch expr.(type) {
+			case *IdentExpr, *MemberExpr, *CallExpr, *IndexExpr, *FuncExpr:
+			default:
+				return nil, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: expression is not callable", ErrorInvalidCall))
+			}
+
+			args, err := p.parseArguments()
+			if err != nil {
+				return nil, err
+			}
+
+			expr = &CallExpr{Callee: expr, Args: args, Info: expr.Pos(), Span: p.spanFrom(start)}
+		case lexer.BracketStart:
+			p.inx++
+
+			index, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+
+			if _, err := p.expect(lexer.BracketEnd); err != nil {
+				return nil, err
+			}
+
+			expr = &IndexExpr{Object: expr, Index: index, Info: getInfo(tok), Span: p.spanFrom(start)}
+		case lexer.Dot:
+			p.inx++
+
+			name, err := p.nextOperand()
+			if err != nil {
+				return nil, err
+			}
+
+			// Keywords can be field names too: request.in
+			if !isName(name.Value) {
+				return nil, NewErrWithPos(getInfo(name), fmt.Errorf("%w: expected a name after '.', got '%s'", ErrorUnexpectedToken, name.Value))
+			}
+
+			expr = &MemberExpr{Object: expr, Name: name.Value, Info: getInfo(name), Span: p.spanFrom(start)}
+		default:
+			return expr, nil
+		}
+	}
+
+	return expr, nil
+}
+
+// parseArguments parses the arguments of a call after the opening parenthesis
+func (p *Parser) parseArguments() ([]Expr, error) {
+	if p.peek().Type == lexer.ParantesisEnd {
+		p.inx++
+		return nil, nil
+	}
+
+	var args []Expr
+	for {
+		if tok := p.peek(); tok.Type == lexer.ParantesisEnd {
+			return nil, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: missing argument", ErrorInvalidParameter))
+		}
+
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+
+		if ok, err := p.separator(lexer.ParantesisEnd); err != nil || !ok {
+			return args, err
+		}
+	}
+}
+
+// parseList parses the items of a list literal after the opening bracket
+func (p *Parser) parseList(start lexer.LexerToken) (Expr, error) {
+	list := &ListExpr{Info: getInfo(start)}
+
+	for {
+		if p.peek().Type == lexer.BracketEnd {
+			p.inx++
+			list.Span = p.spanFrom(list.Info)
+			return list, nil
+		}
+
+		item, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, item)
+
+		if ok, err := p.separator(lexer.BracketEnd); err != nil || !ok {
+			list.Span = p.spanFrom(list.Info)
+			return list, err
+		}
+	}
+}
+
+// parseMap parses the key-value pairs of a map literal after the opening brace
+func (p *Parser) parseMap(start lexer.LexerToken) (Expr, error) {
+	m := &MapExpr{Info: getInfo(start)}
+
+	for {
+		if p.peek().Type == lexer.CurlyBraceEnd {
+			p.inx++
+			m.Span = p.spanFrom(m.Info)
+			return m, nil
+		}
+
+		key, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := p.expect(lexer.Colon); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		m.Keys = append(m.Keys, key)
+		m.Values = append(m.Values, value)
+
+		if ok, err := p.separator(lexer.CurlyBraceEnd); err != nil || !ok {
+			m.Span = p.spanFrom(m.Info)
+			return m, err
+		}
+	}
+}
+
+// separator consumes a comma or the closing token of a literal.
+// It reports whether more items may follow.
+func (p *Parser) separator(end lexer.Token) (bool, error) {
+	tok, err := p.nextOperand()
+	if err != nil {
+		return false, err
+	}
+
+	switch tok.Type {
+	case lexer.Comma:
+		return true, nil
+	case end:
+		return false, nil
+	}
+
+	return false, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: expected ',' or '%s', got '%s'", ErrorUnexpectedToken, end, tok.Value))
+}
+
+// nextOperand consumes the next token of an incomplete expression
+func (p *Parser) nextOperand() (lexer.LexerToken, error) {
+	if p.eof() {
+		return lexer.LexerToken{}, p.errEOF("incomplete expression")
+	}
+
+	return p.next(), nil
+}
+
+// parseNumber parses a number token. Hexadecimal numbers are stored
+// as decimal numbers, numbers with a fraction or an exponent are floats.
+func parseNumber(tok lexer.LexerToken) (Expr, error) {
+	value := tok.Value
+	info := getInfo(tok)
+
+	if strings.HasPrefix(value, "0x") || strings.HasPrefix(value, "0X") {
+		n, err := strconv.ParseInt(value[2:], 16, strconv.IntSize)
+		if err != nil {
+			return nil, NewErrWithPos(info, fmt.Errorf("%w: number '%s' is out of range", ErrorInvalidValue, value))
+		}
+		return &LiteralExpr{Type: VarNumber, Value: strconv.FormatInt(n, 10), Info: info, Span: tokenSpan(tok)}, nil
+	}
+
+	if strings.ContainsAny(value, ".eE") {
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, NewErrWithPos(info, fmt.Errorf("%w: number '%s' is out of range", ErrorInvalidValue, value))
+		}
+		return &LiteralExpr{Type: VarFloat, Value: value, Info: info, Span: tokenSpan(tok)}, nil
+	}
+
+	if _, err := strconv.Atoi(value); err != nil {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: number '%s' is out of range", ErrorInvalidValue, value))
+	}
+	return &LiteralExpr{Type: VarNumber, Value: value, Info: info, Span: tokenSpan(tok)}, nil
+}
+
+func unexpectedToken(tok lexer.LexerToken) error {
+	return NewErrWithSpan(tokenSpan(tok), fmt.Errorf("%w: '%s' in expression", ErrorUnexpectedToken, tok.Value))
+}
+
+// templateContent returns the trimmed content of a template token
+func templateContent(tok lexer.LexerToken) string {
+	value := strings.TrimPrefix(tok.Value, lexer.TemplateStart.String())
+	value = strings.TrimSuffix(value, lexer.TemplateEnd.String())
+	return strings.TrimSpace(value)
+}
+
+// templateInfo returns the position of the first character of a template's
+// content. The content is trimmed, so the leading whitespace is skipped too.
+func templateInfo(tok lexer.LexerToken) NodeFileInfo {
+	info := getInfo(tok)
+	info.Pos += len(lexer.TemplateStart.String())
+
+	content := strings.TrimPrefix(tok.Value, lexer.TemplateStart.String())
+	for _, ch := range content {
+		if !unicode.IsSpace(ch) {
+			break
+		}
+
+		info.Pos++
+		if ch == '\n' {
+			info.Line++
+			info.Pos = 1
+		}
+	}
+
+	return info
+}
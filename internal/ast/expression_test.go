@@ -0,0 +1,114 @@
+package ast
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+)
+
+// sexpr renders an expression with explicit parentheses
+func sexpr(e Expr) string {
+	switch e := e.(type) {
+	case *LiteralExpr:
+		return e.Value
+	case *IdentExpr:
+		return e.Name
+	case *MemberExpr:
+		return sexpr(e.Object) + "." + e.Name
+	case *CallExpr:
+		args := make([]string, len(e.Args))
+		for i, arg := range e.Args {
+			args[i] = sexpr(arg)
+		}
+		return sexpr(e.Callee) + "(" + strings.Join(args, ", ") + ")"
+	case *IndexExpr:
+		return sexpr(e.Object) + "[" + sexpr(e.Index) + "]"
+	case *ListExpr:
+		items := make([]string, len(e.Items))
+		for i, item := range e.Items {
+			items[i] = sexpr(item)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case *MapExpr:
+		items := make([]string, len(e.Keys))
+		for i := range e.Keys {
+			items[i] = sexpr(e.Keys[i]) + ": " + sexpr(e.Values[i])
+		}
+		return "{" + strings.Join(items, ", ") + "}"
+	case *UnaryExpr:
+		return "(" + e.Operator + sexpr(e.Operand) + ")"
+	case *BinaryExpr:
+		return "(" + sexpr(e.Left) + " " + e.Operator + " " + sexpr(e.Right) + ")"
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+func TestParseExpression(t *testing.T) {
+	tests := map[string]string{
+		`1 + 2 * 3`:                 "(1 + (2 * 3))",
+		`(1 + 2) * 3`:               "((1 + 2) * 3)",
+		`10 - 4 - 3`:                "((10 - 4) - 3)",
+		`-a * b`:                    "((-a) * b)",
+		`!done && a < b || c >= 2`:  "(((!done) && (a < b)) || (c >= 2))",
+		`a == 1 != false`:           "((a == 1) != false)",
+		`max(a + 1, f(b)) % 2.5`:    "(max((a + 1), f(b)) % 2.5)",
+		`strs.trim(name) + "!"`:     "(strs.trim(name) + !)",
+		`user.name`:                 "user.name",
+		`x <= 3 && y > -1`:          "((x <= 3) && (y > (-1)))",
+		`add((1 + 2) * 3, (4), ok)`: "add(((1 + 2) * 3), 4, ok)",
+		`[1, a + 2, []]`:            "[1, (a + 2), []]",
+		`{"a": [1], "b": {}}`:       "{a: [1], b: {}}",
+		`users[0]["name"]`:          "users[0][name]",
+		`api.data[i + 1].title`:     "api.data[(i + 1)].title",
+		`list.length - 1`:           "(list.length - 1)",
+		`0xFF + 1.5e2`:              "(255 + 1.5e2)",
+		`a.b(1).c[0].d()`:           "a.b(1).c[0].d()",
+		`request.in`:                "request.in",
+	}
+
+	for src, want := range tests {
+		tokens, err := lexer.Tokenize("test.smt", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expr, err := ParseExpression(tokens)
+		if err != nil {
+			t.Fatalf("%s: %v", src, err)
+		}
+
+		if got := sexpr(expr); got != want {
+			t.Errorf("%s: want %s, got %s", src, want, got)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	tests := []string{
+		`1 +`,
+		`(1 + 2`,
+		`1 2`,
+		`f(1,)`,
+		`* 2`,
+		`[1, 2`,
+		`a[]`,
+		`{"a" 1}`,
+		`1(2)`,
+		`a.`,
+		`a.1`,
+		`99999999999999999999`,
+	}
+
+	for _, src := range tests {
+		tokens, err := lexer.Tokenize("test.smt", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ParseExpression(tokens); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
@@ -4,21 +4,28 @@ import (
 	"path/filepath"
 	"strconv"
 
-	"github.com/bndrmrtn/smarti/internal/lexer"
 	"github.com/fatih/color"
 )
 
-type Node struct {
-	IsReference bool        `json:"is_reference" yaml:"is_reference"`
-	Token       lexer.Token `json:"token" yaml:"token"`
-	Name        string      `json:"name,omitempty" yaml:"name,omitempty"`
-	Type        NodeType    `json:"type" yaml:"type"`
-	Value       string      `json:"value,omitempty" yaml:"value,omitempty"`
-	Args        []Node      `json:"args,omitempty" yaml:"args,omitempty"`
-	Children    []Node      `json:"children,omitempty" yaml:"children,omitempty"`
-	Scope       NodeScope   `json:"scope,omitempty" yaml:"scope,omitempty"`
+// Node is a node of the syntax tree: a statement, a declaration or an expression
+type Node interface {
+	// Pos returns the position of the node that is used in errors,
+	// like the operator of a binary expression
+	Pos() NodeFileInfo
+	// Range returns the range of source code the node was parsed from
+	Range() Span
+}
+
+// Stmt is a statement of a block
+type Stmt interface {
+	Node
+	stmtNode()
+}
 
-	Info NodeFileInfo `json:"info,omitempty" yaml:"info,omitempty"`
+// Decl is a statement that declares a name in its scope
+type Decl interface {
+	Stmt
+	DeclName() string
 }
 
 type NodeFileInfo struct {
@@ -37,6 +44,13 @@ func (n NodeFileInfo) String() string {
 	return str
 }
 
+// Span is a range of source code. End is the position
+// right after the last character of the range.
+type Span struct {
+	Start NodeFileInfo `json:"start" yaml:"start"`
+	End   NodeFileInfo `json:"end" yaml:"end"`
+}
+
 type NodeScope string
 
 const (
@@ -45,3 +59,211 @@ const (
 	ScopeBlock  NodeScope = "block"
 	ScopeFunc   NodeScope = "func"
 )
+
+// NamespaceStmt sets the namespace of a file: namespace main;
+type NamespaceStmt struct {
+	Name string       `json:"name" yaml:"name"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// UseStmt imports a package with an optional alias: use response as rw;
+// A module is imported by its path, Package is empty: use "./lib/users.smt" as users;
+type UseStmt struct {
+	Package string       `json:"package,omitempty" yaml:"package,omitempty"`
+	Path    string       `json:"path,omitempty" yaml:"path,omitempty"`
+	Alias   string       `json:"alias" yaml:"alias"`
+	Info    NodeFileInfo `json:"info" yaml:"info"`
+	Span    Span         `json:"span" yaml:"span"`
+}
+
+// VarDecl declares a variable or a constant: let name = value;
+// A declaration without a value declares nil. Exported constants
+// can be accessed by the files that use the module.
+type VarDecl struct {
+	Const  bool         `json:"const,omitempty" yaml:"const,omitempty"`
+	Export bool         `json:"export,omitempty" yaml:"export,omitempty"`
+	Name   string       `json:"name" yaml:"name"`
+	Value  Expr         `json:"value,omitempty" yaml:"value,omitempty"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// Param is a parameter of a function or a component, or a variable of a for-in loop
+type Param struct {
+	Name string       `json:"name" yaml:"name"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// FuncDecl declares a function. Methods of a type are named type#name,
+// their first parameter is the value they are called on. Exported functions
+// can be called by the files that use the module.
+type FuncDecl struct {
+	Name   string       `json:"name" yaml:"name"`
+	Export bool         `json:"export,omitempty" yaml:"export,omitempty"`
+	Params []*Param     `json:"params,omitempty" yaml:"params,omitempty"`
+	Body   *BlockStmt   `json:"body" yaml:"body"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// ComponentDecl declares a template component. A body with a single
+// template returns the template.
+type ComponentDecl struct {
+	Name   string       `json:"name" yaml:"name"`
+	Params []*Param     `json:"params,omitempty" yaml:"params,omitempty"`
+	Body   *BlockStmt   `json:"body" yaml:"body"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// TypeDecl declares an object type with its fields: type User { name, email }
+// Calling the type creates an object, the arguments are the values of the fields.
+type TypeDecl struct {
+	Name   string       `json:"name" yaml:"name"`
+	Fields []*Param     `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// AssignStmt assigns a value to a variable, a list item, a map key or a field.
+// The `++` and `--` statements are assignments of `target + 1` and `target - 1`.
+type AssignStmt struct {
+	Target Expr         `json:"target" yaml:"target"`
+	Value  Expr         `json:"value" yaml:"value"`
+	Info   NodeFileInfo `json:"info" yaml:"info"`
+	Span   Span         `json:"span" yaml:"span"`
+}
+
+// ExprStmt is an expression used as a statement, like a function call
+type ExprStmt struct {
+	Expr Expr `json:"expr" yaml:"expr"`
+	Span Span `json:"span" yaml:"span"`
+}
+
+// CatchStmt is a statement followed by the @err macro: let data = json.from(s) @err;
+// The error of the statement is stored in the variable Name instead of stopping the code.
+type CatchStmt struct {
+	Stmt Stmt         `json:"stmt" yaml:"stmt"`
+	Name string       `json:"name" yaml:"name"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// ReturnStmt returns from a function or a file. Value is nil for `return;`.
+type ReturnStmt struct {
+	Value Expr         `json:"value,omitempty" yaml:"value,omitempty"`
+	Info  NodeFileInfo `json:"info" yaml:"info"`
+	Span  Span         `json:"span" yaml:"span"`
+}
+
+// BlockStmt is a list of statements between curly braces
+type BlockStmt struct {
+	Stmts []Stmt `json:"stmts,omitempty" yaml:"stmts,omitempty"`
+	Span  Span   `json:"span" yaml:"span"`
+}
+
+// IfStmt runs Then if the condition is true, Else otherwise.
+// Else is a *BlockStmt, an *IfStmt for `else if` or nil.
+type IfStmt struct {
+	Cond Expr         `json:"cond" yaml:"cond"`
+	Then *BlockStmt   `json:"then" yaml:"then"`
+	Else Stmt         `json:"else,omitempty" yaml:"else,omitempty"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// WhileStmt runs the body while the condition is true
+type WhileStmt struct {
+	Cond Expr         `json:"cond" yaml:"cond"`
+	Body *BlockStmt   `json:"body" yaml:"body"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// ForStmt is a C-style for loop: for let i = 0; i < 10; i++ { }
+// Init, Cond and Post are nil when they are omitted.
+type ForStmt struct {
+	Init Stmt         `json:"init,omitempty" yaml:"init,omitempty"`
+	Cond Expr         `json:"cond,omitempty" yaml:"cond,omitempty"`
+	Post Stmt         `json:"post,omitempty" yaml:"post,omitempty"`
+	Body *BlockStmt   `json:"body" yaml:"body"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	Span Span         `json:"span" yaml:"span"`
+}
+
+// ForInStmt iterates over a list, a map or a string: for key, value in items { }
+// Vars holds the item, or the key and the value.
+type ForInStmt struct {
+	Vars       []*Param     `json:"vars" yaml:"vars"`
+	Collection Expr         `json:"collection" yaml:"collection"`
+	Body       *BlockStmt   `json:"body" yaml:"body"`
+	Info       NodeFileInfo `json:"info" yaml:"info"`
+	Span       Span         `json:"span" yaml:"span"`
+}
+
+// BranchStmt is a break or a continue statement
+type BranchStmt struct {
+	Continue bool         `json:"continue,omitempty" yaml:"continue,omitempty"`
+	Info     NodeFileInfo `json:"info" yaml:"info"`
+	Span     Span         `json:"span" yaml:"span"`
+}
+
+func (n *NamespaceStmt) Pos() NodeFileInfo { return n.Info }
+func (n *UseStmt) Pos() NodeFileInfo       { return n.Info }
+func (n *VarDecl) Pos() NodeFileInfo       { return n.Info }
+func (n *Param) Pos() NodeFileInfo         { return n.Info }
+func (n *FuncDecl) Pos() NodeFileInfo      { return n.Info }
+func (n *ComponentDecl) Pos() NodeFileInfo { return n.Info }
+func (n *TypeDecl) Pos() NodeFileInfo      { return n.Info }
+func (n *AssignStmt) Pos() NodeFileInfo    { return n.Info }
+func (n *ExprStmt) Pos() NodeFileInfo      { return n.Expr.Pos() }
+func (n *CatchStmt) Pos() NodeFileInfo     { return n.Info }
+func (n *ReturnStmt) Pos() NodeFileInfo    { return n.Info }
+func (n *BlockStmt) Pos() NodeFileInfo     { return n.Span.Start }
+func (n *IfStmt) Pos() NodeFileInfo        { return n.Info }
+func (n *WhileStmt) Pos() NodeFileInfo     { return n.Info }
+func (n *ForStmt) Pos() NodeFileInfo       { return n.Info }
+func (n *ForInStmt) Pos() NodeFileInfo     { return n.Info }
+func (n *BranchStmt) Pos() NodeFileInfo    { return n.Info }
+
+func (n *NamespaceStmt) Range() Span { return n.Span }
+func (n *UseStmt) Range() Span       { return n.Span }
+func (n *VarDecl) Range() Span       { return n.Span }
+func (n *Param) Range() Span         { return n.Span }
+func (n *FuncDecl) Range() Span      { return n.Span }
+func (n *ComponentDecl) Range() Span { return n.Span }
+func (n *TypeDecl) Range() Span      { return n.Span }
+func (n *AssignStmt) Range() Span    { return n.Span }
+func (n *ExprStmt) Range() Span      { return n.Span }
+func (n *CatchStmt) Range() Span     { return n.Span }
+func (n *ReturnStmt) Range() Span    { return n.Span }
+func (n *BlockStmt) Range() Span     { return n.Span }
+func (n *IfStmt) Range() Span        { return n.Span }
+func (n *WhileStmt) Range() Span     { return n.Span }
+func (n *ForStmt) Range() Span       { return n.Span }
+func (n *ForInStmt) Range() Span     { return n.Span }
+func (n *BranchStmt) Range() Span    { return n.Span }
+
+func (*NamespaceStmt) stmtNode() {}
+func (*UseStmt) stmtNode()       {}
+func (*VarDecl) stmtNode()       {}
+func (*FuncDecl) stmtNode()      {}
+func (*ComponentDecl) stmtNode() {}
+func (*TypeDecl) stmtNode()      {}
+func (*AssignStmt) stmtNode()    {}
+func (*ExprStmt) stmtNode()      {}
+func (*CatchStmt) stmtNode()     {}
+func (*ReturnStmt) stmtNode()    {}
+func (*BlockStmt) stmtNode()     {}
+func (*IfStmt) stmtNode()        {}
+func (*WhileStmt) stmtNode()     {}
+func (*ForStmt) stmtNode()       {}
+func (*ForInStmt) stmtNode()     {}
+func (*BranchStmt) stmtNode()    {}
+
+func (n *VarDecl) DeclName() string       { return n.Name }
+func (n *FuncDecl) DeclName() string      { return n.Name }
+func (n *ComponentDecl) DeclName() string { return n.Name }
+func (n *TypeDecl) DeclName() string      { return n.Name }
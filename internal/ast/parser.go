@@ -1,398 +1,969 @@
 package ast
 
 import (
-	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/bndrmrtn/smarti/internal/lexer"
 )
 
+// Parser is a recursive-descent parser that turns the tokens of a file
+// into statements. The grammar is described in grammar.md.
 type Parser struct {
 	tokens []lexer.LexerToken
-
-	Nodes []Node
+	inx    int
+
+	// inLoop is set while parsing the body of a loop, for break and continue
+	inLoop bool
+	// depth is the number of blocks around the statement being parsed
+	depth int
+	// decls holds the variables and the package aliases declared in the block being parsed
+	decls map[string]Stmt
+
+	Nodes []Stmt
+	// Diagnostics holds the problems found by Parse, the errors and the warnings
+	Diagnostics Diagnostics
 }
 
 func NewParser(tokens []lexer.LexerToken) *Parser {
 	return &Parser{
 		tokens: tokens,
-		Nodes:  make([]Node, 0),
+		Nodes:  make([]Stmt, 0),
 	}
 }
 
+// Parse parses the tokens into statements. A statement with an error is
+// skipped and the parsing goes on, so every problem of the file is collected
+// into Diagnostics. The variables of the statements are checked by a resolver
+// pass. The diagnostics are sorted by their position in the file.
+// The returned error holds the diagnostics if any of them is an error.
 func (p *Parser) Parse() error {
-	return p.parse()
+	for {
+		p.Nodes = append(p.Nodes, p.parseStmts()...)
+		if p.eof() {
+			break
+		}
+
+		// A closing curly brace without an opening one
+		p.report(unexpectedToken(p.next()))
+	}
+
+	r := &resolver{report: p.report}
+	r.resolveFile(p.Nodes)
+
+	sort.SliceStable(p.Diagnostics, func(i, j int) bool {
+		a, b := p.Diagnostics[i].Span.Start, p.Diagnostics[j].Span.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Pos < b.Pos
+	})
+
+	if p.Diagnostics.HasErrors() {
+		return p.Diagnostics
+	}
+	return nil
 }
 
-func (p *Parser) parse() error {
+// parseStmts parses the statements of a block until a closing curly brace
+// or the end of the tokens. The statements with errors are reported and left out.
+func (p *Parser) parseStmts() []Stmt {
+	outer := p.decls
+	p.decls = make(map[string]Stmt)
+	defer func() { p.decls = outer }()
+
 	var (
-		inx      = 0
-		tokenLen = len(p.tokens)
+		stmts       []Stmt
+		unreachable bool
 	)
 
-	for inx < tokenLen {
-		token := p.tokens[inx]
-		inx++
-
-		switch token.Type {
-		case lexer.Let, lexer.Const:
-			name := p.tokens[inx].Value
-			value := []lexer.LexerToken{}
-			inx++
-			if inx < tokenLen && p.tokens[inx].Type == lexer.Assign {
-				inx++
-				for inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-					value = append(value, p.tokens[inx])
-					inx++
-				}
-			} else {
-				value = append(value, lexer.LexerToken{
-					Type:  lexer.Nil,
-					Value: "nil",
-				})
-			}
-
-			if err := p.canAssign(name, true); err != nil {
-				return err
-			}
+	for !p.eof() && p.peek().Type != lexer.CurlyBraceEnd {
+		// Empty statement
+		if p.peek().Type == lexer.SemiColon {
+			p.inx++
+			continue
+		}
 
-			n := Node{
-				Token: token.Type,
-				Name:  name,
-			}
+		start := p.inx
+		stmt, err := p.parseStmt()
+		if err != nil {
+			p.report(err)
+			p.sync(start)
+			continue
+		}
 
-			bindValue(value, &n)
+		if unreachable {
+			p.warn(NewErrWithSpan(stmt.Range(), fmt.Errorf("%w: the statements after return, break or continue never run", ErrorUnreachableCode)))
+			unreachable = false
+		}
 
-			p.Nodes = append(p.Nodes, n)
-			continue
-		case lexer.Assign:
-			if inx-2 < 0 {
-				return errors.New("syntax error: missing variable name")
-			}
-			name := p.tokens[inx-2].Value
-			value := []lexer.LexerToken{}
+		switch stmt.(type) {
+		case *ReturnStmt, *BranchStmt:
+			unreachable = true
+		}
 
-			for inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-				value = append(value, p.tokens[inx])
-				inx++
-			}
+		stmts = append(stmts, stmt)
+	}
 
-			if err := p.canAssign(name, false); err != nil {
-				return err
-			}
+	return stmts
+}
 
-			n := Node{
-				Token: lexer.Assign,
-				Name:  name,
+// sync skips the statement that starts at the token with the given index.
+// The statement ends at a semicolon or at a block that closes it, the tokens
+// between parentheses, brackets and curly braces belong to the statement.
+// A closing curly brace of the enclosing block or a keyword that starts
+// a new statement ends it too.
+func (p *Parser) sync(start int) {
+	p.inx = start + 1
+	depth := 0
+
+	for !p.eof() {
+		switch tok := p.peek(); tok.Type {
+		case lexer.ParantesisStart, lexer.BracketStart, lexer.CurlyBraceStart:
+			depth++
+		case lexer.ParantesisEnd, lexer.BracketEnd:
+			depth = max(depth-1, 0)
+		case lexer.CurlyBraceEnd:
+			if depth == 0 {
+				return
 			}
 
-			bindValue(value, &n)
-
-			p.Nodes = append(p.Nodes, n)
-			continue
-		case lexer.Use:
-			pkgToken := p.tokens[inx]
-			pkg := pkgToken.Value
-			as := pkg
-			if inx+3 < tokenLen && p.tokens[inx+1].Value == "as" {
-				inx += 2
-				as = p.tokens[inx].Value
-				if p.tokens[inx+1].Type != lexer.SemiColon {
-					return errors.New("syntax error: missing semicolon")
-				}
-			} else if inx+1 < tokenLen && p.tokens[inx+1].Type != lexer.SemiColon {
-				return errors.New("syntax error: missing semicolon")
+			depth--
+			if depth == 0 && p.inx+1 < len(p.tokens) && p.tokens[p.inx+1].Type != lexer.Else {
+				// A block ends the statement, unless an else branch follows
+				p.inx++
+				return
 			}
-			p.Nodes = append(p.Nodes, Node{
-				Token: lexer.Use,
-				Type:  UsePackage,
-				Name:  pkg,
-				Value: as,
-				Info:  getInfo(pkgToken),
-			})
-		case lexer.Namespace:
-			name := p.tokens[inx].Value
-			info := getInfo(p.tokens[inx])
-			inx++
-			if inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-				return errors.New("syntax error: missing semicolon")
+		case lexer.SemiColon:
+			if depth == 0 {
+				p.inx++
+				return
 			}
-			p.Nodes = append(p.Nodes, Node{
-				Token: lexer.Namespace,
-				Type:  Namespace,
-				Name:  name,
-				Info:  info,
-			})
-		case lexer.Func:
-			name, args := getFuncCall(p.tokens[inx])
-			info := getInfo(p.tokens[inx])
-			inx++
-
-			body := []lexer.LexerToken{}
-			for inx < tokenLen && p.tokens[inx].Type != lexer.CurlyBraceEnd {
-				body = append(body, p.tokens[inx])
-				inx++
+		default:
+			// A function literal is a part of the statement: let f = func(x) { }
+			if depth == 0 && startsStmt(tok.Type) && !p.isFuncExpr() {
+				return
 			}
+		}
 
-			psr := NewParser(body)
-			if err := psr.Parse(); err != nil {
-				return err
-			}
+		p.inx++
+	}
+}
 
-			for j := range psr.Nodes {
-				psr.Nodes[j].Scope = ScopeFunc
-			}
+// isFuncExpr reports whether the next tokens are a function literal: func(
+func (p *Parser) isFuncExpr() bool {
+	return p.inx+1 < len(p.tokens) && p.tokens[p.inx].Type == lexer.Func && p.tokens[p.inx+1].Type == lexer.ParantesisStart
+}
 
-			p.Nodes = append(p.Nodes, Node{
-				Token:    lexer.Func,
-				Type:     FuncDecl,
-				Children: psr.Nodes,
-				Name:     name,
-				Args:     args,
-				Info:     info,
-			})
-		case lexer.FuncCall:
-			name, args := getFuncCall(token)
-			p.Nodes = append(p.Nodes, Node{
-				Token: lexer.FuncCall,
-				Type:  FuncCall,
-				Name:  name,
-				Args:  args,
-				Info:  getInfo(token),
-			})
-		case lexer.Return:
-			returnsRaw := []lexer.LexerToken{}
-			for inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-				returnsRaw = append(returnsRaw, p.tokens[inx])
-				inx++
-			}
+// startsStmt reports whether a token can only be the first token of a statement
+func startsStmt(t lexer.Token) bool {
+	switch t {
+	case lexer.Let, lexer.Const, lexer.Func, lexer.Component, lexer.If, lexer.While, lexer.For,
+		lexer.Return, lexer.Break, lexer.Continue, lexer.Namespace, lexer.Use, lexer.Export:
+		return true
+	}
+	return false
+}
 
-			var returns Node
-			bindValue(returnsRaw, &returns)
+// report adds an error to the diagnostics
+func (p *Parser) report(err error) {
+	p.diagnose(SeverityError, err)
+}
 
-			n := Node{
-				Token:    lexer.Return,
-				Type:     FuncReturn,
-				Children: []Node{returns},
-			}
-			p.Nodes = append(p.Nodes, n)
-		case lexer.If:
-			var (
-				conditionTokens []lexer.LexerToken
-				bodyTokens      []lexer.LexerToken
-			)
-
-			for inx < tokenLen && p.tokens[inx].Type != lexer.CurlyBraceStart {
-				conditionTokens = append(conditionTokens, p.tokens[inx])
-				inx++
-			}
+// warn adds a warning to the diagnostics, warnings do not make Parse fail
+func (p *Parser) warn(err error) {
+	p.diagnose(SeverityWarning, err)
+}
 
-			if inx >= tokenLen || p.tokens[inx].Type != lexer.CurlyBraceStart {
-				return errors.New("syntax error: missing opening curly brace for if statement")
-			}
+func (p *Parser) diagnose(severity Severity, err error) {
+	d := NewDiagnostic(severity, err)
 
-			for inx >= tokenLen || p.tokens[inx].Type != lexer.CurlyBraceStart {
-				inx++
+	// Errors at a single position cover the token at the position
+	if d.Span.Start == d.Span.End {
+		for _, tok := range p.tokens {
+			if start := getInfo(tok); start == d.Span.Start {
+				d.Span.End = getEnd(tok)
+				break
 			}
+		}
+	}
 
-			depth := 0
+	p.Diagnostics = append(p.Diagnostics, d)
+}
 
-			if inx >= tokenLen || p.tokens[inx].Type != lexer.CurlyBraceStart {
-				return errors.New("syntax error: missing opening curly brace")
-			}
+func (p *Parser) parseStmt() (Stmt, error) {
+	tok := p.peek()
+
+	switch tok.Type {
+	case lexer.Namespace:
+		return p.parseNamespace()
+	case lexer.Use:
+		return p.parseUse()
+	case lexer.Export:
+		return p.parseExport()
+	case lexer.Func:
+		return p.parseFunc()
+	case lexer.Component:
+		return p.parseComponent()
+	case lexer.If:
+		return p.parseIf()
+	case lexer.While:
+		return p.parseWhile()
+	case lexer.For:
+		return p.parseFor()
+	case lexer.Return:
+		return p.parseReturn()
+	case lexer.Break, lexer.Continue:
+		return p.parseBranch()
+	case lexer.Else:
+		return nil, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: else without if", ErrorUnexpectedToken))
+	case lexer.Identifier:
+		if p.isTypeDecl() {
+			return p.parseType()
+		}
+	}
 
-			depth++
-			inx++
-
-			for inx < tokenLen {
-				token := p.tokens[inx]
-
-				if token.Type == lexer.CurlyBraceStart {
-					depth++
-				} else if token.Type == lexer.CurlyBraceEnd {
-					depth--
-					if depth == 0 {
-						inx++
-						break
-					}
-				}
-
-				if depth > 0 {
-					bodyTokens = append(bodyTokens, token)
-				}
-
-				inx++
-			}
+	stmt, err := p.parseSimpleStmt()
+	if err != nil {
+		return nil, err
+	}
 
-			if depth != 0 {
-				return errors.New("syntax error: unbalanced curly braces")
-			}
+	if !p.eof() && p.peek().Type == lexer.At {
+		if stmt, err = p.parseMacro(stmt); err != nil {
+			return nil, err
+		}
+	}
 
-			var condition Node
-			bindValue(conditionTokens, &condition)
+	return stmt, p.endStmt()
+}
 
-			bodyParser := NewParser(bodyTokens)
-			if err := bodyParser.Parse(); err != nil {
-				return err
-			}
+// parseMacro parses the macro after a simple statement.
+// The only macro is @err, it catches the error of the statement.
+func (p *Parser) parseMacro(stmt Stmt) (Stmt, error) {
+	at := p.next()
 
-			p.Nodes = append(p.Nodes, Node{
-				Token:    lexer.If,
-				Type:     IfStatement,
-				Args:     []Node{condition},
-				Children: append([]Node{condition}, bodyParser.Nodes...),
-			})
-		case lexer.For:
-			var (
-				initTokens      []lexer.LexerToken
-				conditionTokens []lexer.LexerToken
-				postTokens      []lexer.LexerToken
-				bodyTokens      []lexer.LexerToken
-			)
-
-			// Első szakasz: init
-			for inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-				initTokens = append(initTokens, p.tokens[inx])
-				inx++
-			}
+	name, err := p.expect(lexer.Identifier)
+	if err != nil {
+		return nil, err
+	}
 
-			if inx >= tokenLen || p.tokens[inx].Type != lexer.SemiColon {
-				return errors.New("syntax error: missing semicolon after init statement in for loop")
-			}
-			inx++ // Átlépünk a ';' után
+	if name.Value != "err" {
+		return nil, NewErrWithSpan(Span{Start: getInfo(at), End: getEnd(name)}, fmt.Errorf("%w: unknown macro '@%s'", ErrorUnexpectedToken, name.Value))
+	}
 
-			// Második szakasz: condition
-			for inx < tokenLen && p.tokens[inx].Type != lexer.SemiColon {
-				conditionTokens = append(conditionTokens, p.tokens[inx])
-				inx++
-			}
+	return &CatchStmt{
+		Stmt: stmt,
+		Name: name.Value,
+		Info: getInfo(at),
+		Span: p.spanFrom(stmt.Range().Start),
+	}, nil
+}
 
-			if inx >= tokenLen || p.tokens[inx].Type != lexer.SemiColon {
-				return errors.New("syntax error: missing semicolon after condition statement in for loop")
-			}
-			inx++ // Átlépünk a ';' után
+// parseSimpleStmt parses a statement that can be the init or the post
+// statement of a for loop: a declaration, an assignment or a call
+func (p *Parser) parseSimpleStmt() (Stmt, error) {
+	start := p.peek()
+	if start.Type == lexer.Let || start.Type == lexer.Const {
+		return p.parseVarDecl()
+	}
 
-			// Harmadik szakasz: post
-			for inx < tokenLen && p.tokens[inx].Type != lexer.CurlyBraceStart {
-				postTokens = append(postTokens, p.tokens[inx])
-				inx++
-			}
+	target, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
 
-			if inx >= tokenLen || p.tokens[inx].Type != lexer.CurlyBraceStart {
-				return errors.New("syntax error: missing opening curly brace for for loop body")
-			}
-			inx++ // Átlépünk a '{' után
-
-			// Negyedik szakasz: body
-			depth := 1
-			for inx < tokenLen && depth > 0 {
-				if p.tokens[inx].Type == lexer.CurlyBraceStart {
-					depth++
-				} else if p.tokens[inx].Type == lexer.CurlyBraceEnd {
-					depth--
-					if depth == 0 {
-						break
-					}
-				}
-
-				if depth > 0 {
-					bodyTokens = append(bodyTokens, p.tokens[inx])
-				}
-				inx++
-			}
+	if p.eof() {
+		return exprStmt(target)
+	}
 
-			if depth != 0 {
-				return errors.New("syntax error: unbalanced curly braces in for loop body")
-			}
+	switch op := p.peek(); op.Type {
+	case lexer.Assign:
+		p.inx++
 
-			// Parsoljuk az init, condition és post részeket
-			var initNode, conditionNode, postNode Node
-			bindValue(initTokens, &initNode)
-			bindValue(conditionTokens, &conditionNode)
-			bindValue(postTokens, &postNode)
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
 
-			// Parsoljuk a body-t
-			bodyParser := NewParser(bodyTokens)
-			if err := bodyParser.Parse(); err != nil {
-				return err
-			}
+		return p.assignStmt(target, value)
+	case lexer.Increment, lexer.Decrement:
+		p.inx++
+		return p.assignStmt(target, stepExpr(target, op))
+	}
 
-			// Létrehozzuk a for loop node-ot
-			p.Nodes = append(p.Nodes, Node{
-				Token:    lexer.For,
-				Type:     ForLoop,
-				Args:     []Node{initNode, conditionNode, postNode},
-				Children: bodyParser.Nodes,
-			})
+	return exprStmt(target)
+}
 
-		}
+// exprStmt creates an expression statement. Only calls can be statements,
+// other expressions would be evaluated without using their value.
+func exprStmt(e Expr) (Stmt, error) {
+	if _, ok := e.(*CallExpr); !ok {
+		return nil, NewErrWithSpan(e.Range(), fmt.Errorf("%w: expression is not used", ErrorInvalidStatement))
 	}
 
+	return &ExprStmt{Expr: e, Span: e.Range()}, nil
+}
+
+// assignStmt creates an assignment. Variables, list items, map keys and
+// fields can be assigned, constants are checked by the resolver.
+func (p *Parser) assignStmt(target Expr, value Expr) (Stmt, error) {
+	switch target.(type) {
+	case *IdentExpr, *IndexExpr, *MemberExpr:
+	default:
+		return nil, NewErrWithSpan(target.Range(), fmt.Errorf("%w: invalid assignment target", ErrorInvalidAssignment))
+	}
+
+	return &AssignStmt{
+		Target: target,
+		Value:  value,
+		Info:   target.Pos(),
+		Span:   p.spanFrom(target.Range().Start),
+	}, nil
+}
+
+// stepExpr turns the target of a `++` or `--` statement into `target + 1`
+func stepExpr(target Expr, op lexer.LexerToken) Expr {
+	operator := "+"
+	if op.Type == lexer.Decrement {
+		operator = "-"
+	}
+
+	return &BinaryExpr{
+		Operator: operator,
+		Left:     target,
+		Right:    &LiteralExpr{Type: VarNumber, Value: "1", Info: getInfo(op), Span: tokenSpan(op)},
+		Info:     getInfo(op),
+		Span:     Span{Start: target.Range().Start, End: getEnd(op)},
+	}
+}
+
+// endStmt consumes the semicolon after a statement. It can be omitted
+// before the end of a block or the file.
+func (p *Parser) endStmt() error {
+	if p.eof() || p.peek().Type == lexer.CurlyBraceEnd {
+		return nil
+	}
+
+	tok := p.peek()
+	if tok.Type != lexer.SemiColon {
+		// The semicolon is missing right after the statement, not at the next token
+		return NewErrWithPos(getEnd(p.tokens[p.inx-1]), fmt.Errorf("%w: expected ';', got '%s'", ErrorUnexpectedToken, tok.Value))
+	}
+
+	p.inx++
 	return nil
 }
 
-func (p *Parser) canAssign(name string, create bool) error {
-	for _, n := range p.Nodes {
-		if !create && n.Name == name && n.Token == lexer.Const {
-			return ErrorCannotReAssignConst
+func (p *Parser) parseNamespace() (Stmt, error) {
+	start := p.next()
+
+	name, err := p.expect(lexer.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &NamespaceStmt{Name: name.Value, Info: getInfo(name), Span: p.spanFrom(getInfo(start))}
+	return stmt, p.endStmt()
+}
+
+// parseUse parses the import of a package or a module: use response as rw;
+// A module is imported by its path, the alias is its file name by default:
+// use "./lib/users.smt" as users;
+func (p *Parser) parseUse() (Stmt, error) {
+	start := p.next()
+
+	if p.depth > 0 {
+		return nil, NewErrWithPos(getInfo(start), fmt.Errorf("%w: use is only allowed at the top level of a file", ErrorInvalidStatement))
+	}
+
+	if p.eof() {
+		return nil, p.errEOF("expected a package name or a module path")
+	}
+
+	var (
+		pkg  = p.next()
+		stmt = &UseStmt{Info: getInfo(pkg)}
+	)
+
+	switch pkg.Type {
+	case lexer.Identifier:
+		stmt.Package, stmt.Alias = pkg.Value, pkg.Value
+	case lexer.DoubleStringLiteral, lexer.SingleStringLiteral:
+		stmt.Path = pkg.Value
+		stmt.Alias = strings.TrimSuffix(filepath.Base(pkg.Value), filepath.Ext(pkg.Value))
+	default:
+		return nil, NewErrWithSpan(tokenSpan(pkg), fmt.Errorf("%w: expected a package name or a module path, got '%s'", ErrorUnexpectedToken, pkg.Value))
+	}
+
+	if !p.eof() && p.peek().Type == lexer.Identifier && p.peek().Value == "as" {
+		p.inx++
+
+		as, err := p.expect(lexer.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		stmt.Alias = as.Value
+	} else if stmt.Path != "" && !isName(stmt.Alias) {
+		return nil, NewErrWithSpan(tokenSpan(pkg), fmt.Errorf("%w: module '%s' needs an alias: use \"%s\" as name", ErrorInvalidStatement, stmt.Alias, stmt.Path))
+	}
+
+	stmt.Span = p.spanFrom(getInfo(start))
+	p.decls[stmt.Alias] = stmt
+	return stmt, p.endStmt()
+}
+
+// parseExport parses an exported declaration of a module: export func find(id) { }
+// Functions and constants at the top level of a file can be exported.
+func (p *Parser) parseExport() (Stmt, error) {
+	start := p.next()
+
+	if p.depth > 0 {
+		return nil, NewErrWithPos(getInfo(start), fmt.Errorf("%w: export is only allowed at the top level of a file", ErrorInvalidStatement))
+	}
+
+	switch p.peek().Type {
+	case lexer.Func:
+		stmt, err := p.parseFunc()
+		if err != nil {
+			return nil, err
+		}
+
+		decl := stmt.(*FuncDecl)
+		if strings.Contains(decl.Name, "#") {
+			return nil, NewErrWithPos(decl.Info, fmt.Errorf("%w: method '%s' cannot be exported, only functions and constants can be", ErrorInvalidStatement, decl.Name))
 		}
 
-		if create && n.Name == name {
-			return ErrorCannotReDeclareVar
+		decl.Export = true
+		decl.Span.Start = getInfo(start)
+		return decl, nil
+	case lexer.Const:
+		decl, err := p.parseVarDecl()
+		if err != nil {
+			return nil, err
 		}
+
+		decl.Export = true
+		decl.Span.Start = getInfo(start)
+		return decl, p.endStmt()
 	}
 
-	return nil
+	if p.eof() {
+		return nil, p.errEOF("expected a function or a constant after export")
+	}
+	return nil, NewErrWithSpan(tokenSpan(p.peek()), fmt.Errorf("%w: only functions and constants can be exported, got '%s'", ErrorInvalidStatement, p.peek().Value))
 }
 
-func bindValue(value []lexer.LexerToken, n *Node) {
-	if len(value) == 0 {
-		n.Value = "nil"
-		n.Type = VarNil
-		return
-	}
-
-	if len(value) == 1 {
-		if value[0].Type == lexer.FuncCall {
-			name, args := getFuncCall(value[0])
-			n.Children = append(n.Children, Node{
-				Type: FuncCall,
-				Name: name,
-				Args: args,
-			})
-			n.Type = VarExpression
-			return
-		}
-
-		val, typ, ref := getType(value[0])
-		n.Value = val
-		n.Type = typ
-		n.IsReference = ref
-		return
-	}
-
-	n.Type = VarExpression
-	inx := 0
-	for inx < len(value) {
-		v := value[inx]
-		inx++
-
-		if v.Type == lexer.FuncCall {
-			name, args := getFuncCall(v)
-			n.Children = append(n.Children, Node{
-				Type: FuncCall,
-				Name: name,
-				Args: args,
-				Info: getInfo(v),
-			})
-			continue
+func (p *Parser) parseVarDecl() (*VarDecl, error) {
+	start := p.next()
+
+	name, err := p.expect(lexer.Identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := p.decls[name.Value]; ok {
+		return nil, NewErrWithPos(getInfo(name), fmt.Errorf("%w: '%s'", ErrorCannotReDeclareVar, name.Value))
+	}
+
+	decl := &VarDecl{Const: start.Type == lexer.Const, Name: name.Value, Info: getInfo(start)}
+
+	if !p.eof() && p.peek().Type == lexer.Assign {
+		p.inx++
+
+		decl.Value, err = p.parseExpr()
+		if err != nil {
+			return nil, err
 		}
+	}
+
+	decl.Span = p.spanFrom(getInfo(start))
+	p.decls[decl.Name] = decl
+	return decl, nil
+}
+
+// isTypeDecl reports whether the next tokens start a type declaration: type User {
+// The type keyword is an identifier, so the type() function can still be called.
+func (p *Parser) isTypeDecl() bool {
+	return p.inx+2 < len(p.tokens) && p.tokens[p.inx].Value == "type" &&
+		p.tokens[p.inx+1].Type == lexer.Identifier && p.tokens[p.inx+2].Type == lexer.CurlyBraceStart
+}
+
+// parseType parses a type declaration: type User { name, email }
+func (p *Parser) parseType() (Stmt, error) {
+	start := p.next()
+	name := p.next()
+	p.inx++ // Skip '{'
+
+	// Types are declared once per runtime, a type in a function would be declared by every call
+	if p.depth > 0 {
+		return nil, NewErrWithPos(getInfo(start), fmt.Errorf("%w: type is only allowed at the top level of a file", ErrorInvalidStatement))
+	}
+
+	if _, ok := builtinTypes[NodeType(name.Value)]; ok {
+		return nil, NewErrWithSpan(tokenSpan(name), fmt.Errorf("%w: '%s' is a built-in type", ErrorInvalidType, name.Value))
+	}
+
+	if _, ok := p.decls[name.Value]; ok {
+		return nil, NewErrWithPos(getInfo(name), fmt.Errorf("%w: '%s'", ErrorCannotReDeclareVar, name.Value))
+	}
+
+	decl := &TypeDecl{Name: name.Value, Info: getInfo(name)}
+	fields := make(map[string]bool)
+
+	for {
+		if p.peek().Type == lexer.CurlyBraceEnd {
+			p.inx++
+			break
+		}
+
+		tok, err := p.expect(lexer.Identifier)
+		if err != nil {
+			return nil, err
+		}
+
+		if fields[tok.Value] {
+			return nil, NewErrWithSpan(tokenSpan(tok), fmt.Errorf("%w: duplicate field '%s' of '%s'", ErrorInvalidField, tok.Value, name.Value))
+		}
+		fields[tok.Value] = true
+		decl.Fields = append(decl.Fields, &Param{Name: tok.Value, Info: getInfo(tok), Span: tokenSpan(tok)})
+
+		more, err := p.separator(lexer.CurlyBraceEnd)
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			break
+		}
+	}
+
+	decl.Span = p.spanFrom(getInfo(start))
+	p.decls[name.Value] = decl
+	return decl, nil
+}
+
+func (p *Parser) parseFunc() (Stmt, error) {
+	start := p.next()
+
+	name, params, info, err := p.parseSignature(start)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseFuncBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return &FuncDecl{Name: name, Params: params, Body: body, Info: info, Span: p.spanFrom(getInfo(start))}, nil
+}
+
+// parseComponent parses a component declaration: component Card(title) { <>...</> }
+// A body with a single template returns the template.
+func (p *Parser) parseComponent() (Stmt, error) {
+	start := p.next()
+
+	name, params, info, err := p.parseSignature(start)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isComponentName(name) {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: component name '%s' must start with an uppercase and a lowercase letter, like Card", ErrorInvalidFunction, name))
+	}
+
+	var body *BlockStmt
+	if tpl, ok := p.templateBody(); ok {
+		open := p.next()
+
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+
+		ret := &ReturnStmt{Value: value, Info: getInfo(tpl), Span: tokenSpan(tpl)}
+		if p.peek().Type == lexer.SemiColon {
+			p.inx++
+		}
+
+		p.inx++ // Skip '}'
+		body = &BlockStmt{Stmts: []Stmt{ret}, Span: p.spanFrom(getInfo(open))}
+	} else {
+		body, err = p.parseFuncBody()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &ComponentDecl{Name: name, Params: params, Body: body, Info: info, Span: p.spanFrom(getInfo(start))}, nil
+}
+
+// templateBody reports whether the next block only has a template: { <>...</> }
+func (p *Parser) templateBody() (lexer.LexerToken, bool) {
+	if p.inx+2 >= len(p.tokens) || p.tokens[p.inx].Type != lexer.CurlyBraceStart || p.tokens[p.inx+1].Type != lexer.Template {
+		return lexer.LexerToken{}, false
+	}
+
+	end := p.inx + 2
+	if p.tokens[end].Type == lexer.SemiColon {
+		end++
+	}
+
+	return p.tokens[p.inx+1], end < len(p.tokens) && p.tokens[end].Type == lexer.CurlyBraceEnd
+}
+
+// parseFuncBody parses the body of a function, loops outside of the function
+// do not allow break and continue in it
+func (p *Parser) parseFuncBody() (*BlockStmt, error) {
+	inLoop := p.inLoop
+	p.inLoop = false
+	defer func() { p.inLoop = inLoop }()
+
+	return p.parseBlock()
+}
+
+// parseSignature parses the name and the parameters of a function or
+// a component declaration: name(a, b). Methods are named type#name.
+func (p *Parser) parseSignature(keyword lexer.LexerToken) (string, []*Param, NodeFileInfo, error) {
+	info := getInfo(keyword)
+	if p.eof() || p.peek().Type != lexer.Identifier {
+		return "", nil, info, NewErrWithPos(info, fmt.Errorf("%w: %s expects a name and parameters", ErrorInvalidFunction, keyword.Value))
+	}
+
+	nameTok := p.next()
+	name, info := nameTok.Value, getInfo(nameTok)
+
+	if p.inx+1 < len(p.tokens) && p.peek().Type == lexer.Hash && p.tokens[p.inx+1].Type == lexer.Identifier {
+		name += "#" + p.tokens[p.inx+1].Value
+		p.inx += 2
+	}
+
+	params, err := p.parseParams(name, info)
+	if err != nil {
+		return "", nil, info, err
+	}
+
+	return name, params, info, nil
+}
+
+// parseParams parses the parameters of a function between parentheses: (a, b)
+func (p *Parser) parseParams(name string, info NodeFileInfo) ([]*Param, error) {
+	if p.eof() || p.peek().Type != lexer.ParantesisStart {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: missing parameters of '%s'", ErrorInvalidFunction, name))
+	}
+	p.inx++
+
+	var params []*Param
+	for !p.eof() {
+		tok := p.next()
+
+		if tok.Type == lexer.ParantesisEnd && len(params) == 0 {
+			return params, nil
+		}
+
+		if tok.Type != lexer.Identifier {
+			return nil, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: expected a parameter name, got '%s'", ErrorInvalidParameter, tok.Value))
+		}
+
+		params = append(params, &Param{Name: tok.Value, Info: getInfo(tok), Span: tokenSpan(tok)})
+
+		if p.eof() {
+			break
+		}
+
+		switch sep := p.next(); sep.Type {
+		case lexer.ParantesisEnd:
+			return params, nil
+		case lexer.Comma:
+		default:
+			return nil, NewErrWithPos(getInfo(sep), fmt.Errorf("%w: expected ',' or ')', got '%s'", ErrorUnexpectedToken, sep.Value))
+		}
+	}
+
+	return nil, NewErrWithPos(info, fmt.Errorf("%w: missing ')' after the parameters of '%s'", ErrorUnexpectedEOF, name))
+}
+
+// isComponentName reports whether the name can be used as a tag in templates.
+// Uppercase HTML tags like <BR> are not components, Slot is reserved.
+func isComponentName(name string) bool {
+	runes := []rune(name)
+	return len(runes) > 1 && unicode.IsUpper(runes[0]) && unicode.IsLower(runes[1]) && name != "Slot" && isIdentifier(name)
+}
+
+func (p *Parser) parseReturn() (Stmt, error) {
+	start := p.next()
+	stmt := &ReturnStmt{Info: getInfo(start)}
+
+	if !p.eof() && p.peek().Type != lexer.SemiColon && p.peek().Type != lexer.CurlyBraceEnd {
+		value, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		stmt.Value = value
+	}
+
+	stmt.Span = p.spanFrom(getInfo(start))
+	return stmt, p.endStmt()
+}
+
+func (p *Parser) parseBranch() (Stmt, error) {
+	tok := p.next()
+	info := getInfo(tok)
+
+	if !p.inLoop {
+		errTyp := ErrorInvalidBreak
+		if tok.Type == lexer.Continue {
+			errTyp = ErrorInvalidContinue
+		}
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: %s statement outside of a loop", errTyp, tok.Value))
+	}
+
+	stmt := &BranchStmt{Continue: tok.Type == lexer.Continue, Info: info, Span: tokenSpan(tok)}
+	return stmt, p.endStmt()
+}
+
+// parseIf parses an if statement with its optional else and else-if chain
+func (p *Parser) parseIf() (*IfStmt, error) {
+	start := p.next()
+	info := getInfo(start)
+
+	if p.eof() || p.peek().Type == lexer.CurlyBraceStart {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: if statement requires a condition", ErrorInvalidCondition))
+	}
+
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	then, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &IfStmt{Cond: cond, Then: then, Info: info}
+
+	if !p.eof() && p.peek().Type == lexer.Else {
+		p.inx++
+
+		if !p.eof() && p.peek().Type == lexer.If {
+			stmt.Else, err = p.parseIf()
+		} else {
+			stmt.Else, err = p.parseBlock()
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stmt.Span = p.spanFrom(info)
+	return stmt, nil
+}
+
+func (p *Parser) parseWhile() (Stmt, error) {
+	start := p.next()
+	info := getInfo(start)
+
+	if p.eof() || p.peek().Type == lexer.CurlyBraceStart {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: while loop requires a condition", ErrorInvalidLoop))
+	}
+
+	cond, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := p.parseLoopBody()
+	if err != nil {
+		return nil, err
+	}
+
+	return &WhileStmt{Cond: cond, Body: body, Info: info, Span: p.spanFrom(info)}, nil
+}
+
+func (p *Parser) parseFor() (Stmt, error) {
+	start := p.next()
+	info := getInfo(start)
+
+	if p.isForIn() {
+		return p.parseForIn(info)
+	}
+
+	// The init and post statements have their own scope
+	outer := p.decls
+	p.decls = make(map[string]Stmt)
+	defer func() { p.decls = outer }()
+
+	stmt := &ForStmt{Info: info}
+
+	var err error
+	if p.peek().Type != lexer.SemiColon {
+		if stmt.Init, err = p.parseSimpleStmt(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.expect(lexer.SemiColon); err != nil {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: missing semicolon after init statement in for loop", ErrorInvalidLoop))
+	}
+
+	if p.peek().Type != lexer.SemiColon {
+		if stmt.Cond, err = p.parseExpr(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.expect(lexer.SemiColon); err != nil {
+		return nil, NewErrWithPos(info, fmt.Errorf("%w: missing semicolon after condition statement in for loop", ErrorInvalidLoop))
+	}
+
+	if p.peek().Type != lexer.CurlyBraceStart {
+		if stmt.Post, err = p.parseSimpleStmt(); err != nil {
+			return nil, err
+		}
+	}
+
+	if stmt.Body, err = p.parseLoopBody(); err != nil {
+		return nil, err
+	}
+
+	stmt.Span = p.spanFrom(info)
+	return stmt, nil
+}
+
+// isForIn reports whether the for loop is a for-in loop:
+// for item in list, for key, value in map
+func (p *Parser) isForIn() bool {
+	for i, want := range []lexer.Token{lexer.Identifier, lexer.Comma, lexer.Identifier} {
+		if p.inx+i >= len(p.tokens) {
+			return false
+		}
+
+		if t := p.tokens[p.inx+i].Type; t == lexer.In {
+			return i == 1
+		} else if t != want {
+			return false
+		}
+	}
+
+	return p.inx+3 < len(p.tokens) && p.tokens[p.inx+3].Type == lexer.In
+}
+
+func (p *Parser) parseForIn(info NodeFileInfo) (Stmt, error) {
+	stmt := &ForInStmt{Info: info}
+
+	for p.peek().Type != lexer.In {
+		if tok := p.next(); tok.Type == lexer.Identifier {
+			stmt.Vars = append(stmt.Vars, &Param{Name: tok.Value, Info: getInfo(tok), Span: tokenSpan(tok)})
+		}
+	}
+	p.inx++ // Skip 'in'
+
+	if len(stmt.Vars) == 2 && stmt.Vars[0].Name == stmt.Vars[1].Name {
+		return nil, NewErrWithPos(stmt.Vars[1].Info, fmt.Errorf("%w: '%s'", ErrorCannotReDeclareVar, stmt.Vars[1].Name))
+	}
+
+	// A curly brace after `in` is the body, unless it is a map literal followed by the body
+	missing := NewErrWithPos(info, fmt.Errorf("%w: for-in loop requires a collection", ErrorInvalidLoop))
+	if p.eof() {
+		return nil, missing
+	}
+
+	inx := p.inx
+	collection, err := p.parseExpr()
+	if p.tokens[inx].Type == lexer.CurlyBraceStart && (err != nil || p.peek().Type != lexer.CurlyBraceStart) {
+		return nil, missing
+	}
+	if err != nil {
+		return nil, err
+	}
+	stmt.Collection = collection
+
+	if stmt.Body, err = p.parseLoopBody(); err != nil {
+		return nil, err
+	}
+
+	stmt.Span = p.spanFrom(info)
+	return stmt, nil
+}
+
+// parseLoopBody parses a block that allows break and continue
+func (p *Parser) parseLoopBody() (*BlockStmt, error) {
+	inLoop := p.inLoop
+	p.inLoop = true
+	defer func() { p.inLoop = inLoop }()
+
+	return p.parseBlock()
+}
+
+// parseBlock parses the statements between a pair of curly braces
+func (p *Parser) parseBlock() (*BlockStmt, error) {
+	open, err := p.expect(lexer.CurlyBraceStart)
+	if err != nil {
+		return nil, err
+	}
+
+	p.depth++
+	stmts := p.parseStmts()
+	p.depth--
+
+	if p.eof() {
+		return nil, NewErrWithPos(getInfo(open), fmt.Errorf("%w: missing '}'", ErrorUnexpectedEOF))
+	}
+	p.inx++ // Skip '}'
+
+	return &BlockStmt{Stmts: stmts, Span: p.spanFrom(getInfo(open))}, nil
+}
+
+func (p *Parser) eof() bool {
+	return p.inx >= len(p.tokens)
+}
+
+// peek returns the next token without consuming it. After the
+// last token it returns an empty token.
+func (p *Parser) peek() lexer.LexerToken {
+	if p.eof() {
+		return lexer.LexerToken{Type: lexer.Unknown}
+	}
+	return p.tokens[p.inx]
+}
+
+// next consumes the next token, the caller has to check eof
+func (p *Parser) next() lexer.LexerToken {
+	tok := p.tokens[p.inx]
+	p.inx++
+	return tok
+}
+
+// expect consumes the next token if it has the given type
+func (p *Parser) expect(t lexer.Token) (lexer.LexerToken, error) {
+	if p.eof() {
+		return lexer.LexerToken{}, p.errEOF(fmt.Sprintf("expected '%s'", t))
+	}
+
+	tok := p.next()
+	if tok.Type != t {
+		return tok, NewErrWithPos(getInfo(tok), fmt.Errorf("%w: expected '%s', got '%s'", ErrorUnexpectedToken, t, tok.Value))
+	}
+	return tok, nil
+}
+
+// errEOF returns an unexpected EOF error at the end of the last token
+func (p *Parser) errEOF(msg string) error {
+	info := NodeFileInfo{}
+	if len(p.tokens) > 0 {
+		info = getInfo(p.tokens[len(p.tokens)-1])
+	}
+	return NewErrWithPos(info, fmt.Errorf("%w: %s", ErrorUnexpectedEOF, msg))
+}
 
-		val, typ, ref := getType(v)
-		n.Children = append(n.Children, Node{
-			Value:       val,
-			Type:        typ,
-			IsReference: ref,
-			Info:        getInfo(v),
-		})
+// spanFrom returns the span from start to the end of the last consumed token
+func (p *Parser) spanFrom(start NodeFileInfo) Span {
+	if p.inx == 0 {
+		return Span{Start: start, End: start}
 	}
+	return Span{Start: start, End: getEnd(p.tokens[p.inx-1])}
 }
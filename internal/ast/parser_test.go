@@ -0,0 +1,577 @@
+package ast
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+)
+
+func parseSource(t *testing.T, src string) ([]Stmt, error) {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "main.smt")
+	if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lx := lexer.New(file)
+	if err := lx.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewParser(lx.Tokens)
+	err := ps.Parse()
+	return ps.Nodes, err
+}
+
+func TestParseLoopControl(t *testing.T) {
+	nodes, err := parseSource(t, `
+while true {
+    if false {
+        continue;
+    }
+    break;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loop, ok := nodes[0].(*WhileStmt)
+	if len(nodes) != 1 || !ok {
+		t.Fatalf("expected a single while loop, got %+v", nodes)
+	}
+
+	body := loop.Body.Stmts
+	if len(body) != 2 {
+		t.Fatalf("unexpected while body: %+v", body)
+	}
+
+	if branch, ok := body[0].(*IfStmt).Then.Stmts[0].(*BranchStmt); !ok || !branch.Continue {
+		t.Errorf("expected a continue statement, got %+v", body[0])
+	}
+
+	if branch, ok := body[1].(*BranchStmt); !ok || branch.Continue {
+		t.Errorf("expected a break statement, got %+v", body[1])
+	}
+}
+
+func TestParseLoopControlOutsideLoop(t *testing.T) {
+	tests := map[string]struct {
+		src string
+		err Err
+	}{
+		"break":              {"break;", ErrorInvalidBreak},
+		"continue in if":     {"if true { continue; }", ErrorInvalidContinue},
+		"break in loop func": {"for ;; { func f() { break; } }", ErrorInvalidBreak},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSource(t, tt.src)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected %v, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestParseIfElseChain(t *testing.T) {
+	nodes, err := parseSource(t, `
+if a == 1 {
+    b = 1;
+} else if a == 2 {
+    b = 2;
+} else {
+    b = 3;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt, ok := nodes[0].(*IfStmt)
+	if len(nodes) != 1 || !ok {
+		t.Fatalf("expected a single if statement, got %+v", nodes)
+	}
+
+	elseIf, ok := stmt.Else.(*IfStmt)
+	if !ok {
+		t.Fatalf("expected an else-if branch, got %+v", stmt.Else)
+	}
+
+	block, ok := elseIf.Else.(*BlockStmt)
+	if !ok || len(block.Stmts) != 1 {
+		t.Fatalf("expected an else branch, got %+v", elseIf.Else)
+	}
+
+	if assign, ok := block.Stmts[0].(*AssignStmt); !ok || assign.Target.(*IdentExpr).Name != "b" {
+		t.Errorf("unexpected else body: %+v", block.Stmts[0])
+	}
+}
+
+func TestParseElseWithoutIf(t *testing.T) {
+	_, err := parseSource(t, `else { b = 1; }`)
+	if !errors.Is(err, ErrorUnexpectedToken) {
+		t.Fatalf("expected %v, got %v", ErrorUnexpectedToken, err)
+	}
+}
+
+func TestParseForIn(t *testing.T) {
+	nodes, err := parseSource(t, `
+for key, value in user.roles {
+    continue;
+}
+for item in [1, 2] {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected two for-in loops, got %+v", nodes)
+	}
+
+	first, ok := nodes[0].(*ForInStmt)
+	if !ok {
+		t.Fatalf("expected a for-in loop, got %T", nodes[0])
+	}
+
+	if len(first.Vars) != 2 || first.Vars[0].Name != "key" || first.Vars[1].Name != "value" {
+		t.Fatalf("unexpected for-in variables: %+v", first.Vars)
+	}
+
+	if _, ok := first.Collection.(*MemberExpr); !ok {
+		t.Errorf("expected a member expression as collection, got %T", first.Collection)
+	}
+
+	if len(first.Body.Stmts) != 1 {
+		t.Errorf("unexpected for-in body: %+v", first.Body.Stmts)
+	}
+
+	if second, ok := nodes[1].(*ForInStmt); !ok || len(second.Vars) != 1 || second.Vars[0].Name != "item" {
+		t.Errorf("unexpected for-in loop: %+v", nodes[1])
+	}
+}
+
+func TestParseForInErrors(t *testing.T) {
+	tests := map[string]Err{
+		"for item in { }":      ErrorInvalidLoop,
+		"for a, a in list { }": ErrorCannotReDeclareVar,
+	}
+
+	for src, want := range tests {
+		_, err := parseSource(t, src)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseComponent(t *testing.T) {
+	nodes, err := parseSource(t, `
+component Card(title, children) {
+    <><div>{{ title }}</div></>
+}
+component Badge(label) {
+    let text = label;
+    return <><span>{{ text }}</span></>;
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected two component declarations, got %+v", nodes)
+	}
+
+	card, ok := nodes[0].(*ComponentDecl)
+	if !ok || card.Name != "Card" || len(card.Params) != 2 {
+		t.Fatalf("unexpected component declaration: %+v", nodes[0])
+	}
+
+	body := card.Body.Stmts
+	if _, ok := body[0].(*ReturnStmt); len(body) != 1 || !ok {
+		t.Errorf("expected the template to be returned, got %+v", body)
+	}
+
+	if badge := nodes[1].(*ComponentDecl); len(badge.Body.Stmts) != 2 {
+		t.Errorf("unexpected component body: %+v", badge.Body.Stmts)
+	}
+
+	for _, src := range []string{`component card() { <></> }`, `component BR() { <></> }`, `component Slot() { <></> }`} {
+		if _, err := parseSource(t, src); !errors.Is(err, ErrorInvalidFunction) {
+			t.Errorf("%s: expected %q, got %v", src, ErrorInvalidFunction, err)
+		}
+	}
+}
+
+func TestParseStatements(t *testing.T) {
+	nodes, err := parseSource(t, `
+use response as rw;
+func string#shout(s, mark) {
+    return s + mark;
+}
+rw.write("a".shout("!"));
+users[0].name = "John";
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 4 {
+		t.Fatalf("expected 4 statements, got %+v", nodes)
+	}
+
+	if use, ok := nodes[0].(*UseStmt); !ok || use.Package != "response" || use.Alias != "rw" {
+		t.Errorf("unexpected use statement: %+v", nodes[0])
+	}
+
+	if fn, ok := nodes[1].(*FuncDecl); !ok || fn.Name != "string#shout" || len(fn.Params) != 2 || fn.Params[1].Name != "mark" {
+		t.Errorf("unexpected method declaration: %+v", nodes[1])
+	}
+
+	if stmt, ok := nodes[2].(*ExprStmt); !ok {
+		t.Errorf("unexpected call statement: %+v", nodes[2])
+	} else if name, _ := CalleeName(stmt.Expr.(*CallExpr).Callee); name != "rw.write" {
+		t.Errorf("unexpected callee: %s", name)
+	}
+
+	if assign, ok := nodes[3].(*AssignStmt); !ok {
+		t.Errorf("unexpected assignment: %+v", nodes[3])
+	} else if _, ok := assign.Target.(*MemberExpr); !ok {
+		t.Errorf("unexpected assignment target: %T", assign.Target)
+	}
+
+	tests := map[string]Err{
+		"x + 1;":             ErrorInvalidStatement,
+		"func f(a b) { }":    ErrorUnexpectedToken,
+		"func f(1) { }":      ErrorInvalidParameter,
+		"func (a) { }":       ErrorInvalidFunction,
+		"func f(a, { }":      ErrorInvalidParameter,
+		"f(1, 2,);":          ErrorInvalidParameter,
+		"let s = 'a' + 2 3;": ErrorUnexpectedToken,
+	}
+
+	for src, want := range tests {
+		if _, err := parseSource(t, src); !errors.Is(err, want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseSpans(t *testing.T) {
+	nodes, err := parseSource(t, "let total = price * 2;\nif total > 10 {\n    total++;\n}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	span := func(n Node) [4]int {
+		r := n.Range()
+		return [4]int{r.Start.Line, r.Start.Pos, r.End.Line, r.End.Pos}
+	}
+
+	decl := nodes[0].(*VarDecl)
+	stmt := nodes[1].(*IfStmt)
+	step := stmt.Then.Stmts[0].(*AssignStmt)
+
+	tests := []struct {
+		name string
+		node Node
+		want [4]int
+	}{
+		{"declaration", decl, [4]int{1, 1, 1, 22}},
+		{"value", decl.Value, [4]int{1, 13, 1, 22}},
+		{"operand", decl.Value.(*BinaryExpr).Right, [4]int{1, 21, 1, 22}},
+		{"if", stmt, [4]int{2, 1, 4, 2}},
+		{"condition", stmt.Cond, [4]int{2, 4, 2, 14}},
+		{"block", stmt.Then, [4]int{2, 15, 4, 2}},
+		{"step", step, [4]int{3, 5, 3, 12}},
+	}
+
+	for _, tt := range tests {
+		if got := span(tt.node); got != tt.want {
+			t.Errorf("%s: expected span %v, got %v", tt.name, tt.want, got)
+		}
+	}
+
+	if pos := decl.Value.Pos(); pos.Line != 1 || pos.Pos != 19 {
+		t.Errorf("expected the operator position 1:19, got %d:%d", pos.Line, pos.Pos)
+	}
+}
+
+func TestParseNestedFunc(t *testing.T) {
+	nodes, err := parseSource(t, `
+func outer(a) {
+    func inner(b) {
+        if b { return 1; }
+        return 2;
+    }
+    return inner(a);
+}
+outer(true);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 statements, got %+v", nodes)
+	}
+
+	outer := nodes[0].(*FuncDecl)
+	if len(outer.Body.Stmts) != 2 {
+		t.Fatalf("unexpected outer body: %+v", outer.Body.Stmts)
+	}
+
+	if inner, ok := outer.Body.Stmts[0].(*FuncDecl); !ok || inner.Name != "inner" || len(inner.Body.Stmts) != 2 {
+		t.Errorf("unexpected inner function: %+v", outer.Body.Stmts[0])
+	}
+}
+
+func TestParseRecovery(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.smt")
+	src := `let a = 1
+let b = ;
+func f(x y) {
+    return x;
+}
+if a {
+    let c = * 2;
+    c = 3;
+}
+}
+let ok = 1;
+`
+	if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	lx := lexer.New(file)
+	if err := lx.Parse(); err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewParser(lx.Tokens)
+	err := ps.Parse()
+
+	var diags Diagnostics
+	if !errors.As(err, &diags) {
+		t.Fatalf("expected diagnostics, got %v", err)
+	}
+
+	want := []struct {
+		code      Err
+		line, col int
+		end       int
+	}{
+		{ErrorUnexpectedToken, 1, 10, 10},
+		{ErrorUnexpectedToken, 2, 9, 10},
+		{ErrorUnexpectedToken, 3, 10, 11},
+		{ErrorUnexpectedToken, 7, 13, 14},
+		{ErrorUnexpectedToken, 10, 1, 2},
+	}
+
+	if len(diags) != len(want) {
+		t.Fatalf("expected %d diagnostics, got %d:\n%v", len(want), len(diags), diags)
+	}
+
+	for i, w := range want {
+		d := diags[i]
+		if d.Severity != SeverityError || d.Code != w.code || d.Span.Start.File != file {
+			t.Errorf("diagnostic %d: unexpected %+v", i, d)
+		}
+
+		if d.Span.Start.Line != w.line || d.Span.Start.Pos != w.col || d.Span.End.Pos != w.end {
+			t.Errorf("diagnostic %d: expected %d:%d-%d, got %d:%d-%d", i, w.line, w.col, w.end, d.Span.Start.Line, d.Span.Start.Pos, d.Span.End.Pos)
+		}
+	}
+
+	// The statements around the errors are kept
+	if len(ps.Nodes) != 2 {
+		t.Errorf("expected the if statement and the last declaration, got %+v", ps.Nodes)
+	}
+
+	if stmt, ok := ps.Nodes[0].(*IfStmt); !ok || len(stmt.Then.Stmts) != 1 {
+		t.Errorf("unexpected if statement: %+v", ps.Nodes[0])
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	tokens, err := lexer.Tokenize("main.smt", "func f() {\n    return 1;\n    g();\n}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewParser(tokens)
+	if err := ps.Parse(); err != nil {
+		t.Fatalf("warnings must not fail the parsing, got %v", err)
+	}
+
+	if len(ps.Diagnostics) != 1 || ps.Diagnostics[0].Severity != SeverityWarning || ps.Diagnostics[0].Span.Start.Line != 3 {
+		t.Fatalf("expected an unreachable code warning, got %+v", ps.Diagnostics)
+	}
+
+	if r := ps.Diagnostics[0].Report(); r.Code != string(ErrorUnreachableCode) || r.Hint != ErrorUnreachableCode.Hint() {
+		t.Errorf("expected the code and the hint of unreachable code, got %+v", r)
+	}
+}
+
+func TestParseErrMacro(t *testing.T) {
+	nodes, err := parseSource(t, `let data = read(file) @err;
+write(data) @err`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 2 {
+		t.Fatalf("expected 2 statements, got %d", len(nodes))
+	}
+
+	catch, ok := nodes[0].(*CatchStmt)
+	if !ok {
+		t.Fatalf("expected a catch statement, got %T", nodes[0])
+	}
+
+	if _, ok := catch.Stmt.(*VarDecl); !ok || catch.Name != "err" {
+		t.Errorf("unexpected catch statement: %+v", catch)
+	}
+
+	if catch.Info.Pos != 23 || catch.Span.Start.Pos != 1 || catch.Span.End.Pos != 27 {
+		t.Errorf("unexpected position: %+v %+v", catch.Info, catch.Span)
+	}
+
+	if _, ok := nodes[1].(*CatchStmt).Stmt.(*ExprStmt); !ok {
+		t.Errorf("expected a call in the catch statement, got %+v", nodes[1])
+	}
+
+	_, err = parseSource(t, `read(file) @catch;`)
+	if !errors.Is(err, ErrorUnexpectedToken) {
+		t.Errorf("expected %v for an unknown macro, got %v", ErrorUnexpectedToken, err)
+	}
+}
+
+func TestParseFuncExpr(t *testing.T) {
+	nodes, err := parseSource(t, `let f = func(a, b) { return a + b; };
+sort(items, func(x) { return x; })(1);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fn, ok := nodes[0].(*VarDecl).Value.(*FuncExpr)
+	if !ok {
+		t.Fatalf("expected a function literal, got %T", nodes[0].(*VarDecl).Value)
+	}
+
+	if len(fn.Params) != 2 || len(fn.Body.Stmts) != 1 || fn.Span.Start.Pos != 9 || fn.Span.End.Pos != 37 {
+		t.Errorf("unexpected function literal: %+v", fn)
+	}
+
+	call := nodes[1].(*ExprStmt).Expr.(*CallExpr)
+	if _, ok := call.Callee.(*CallExpr); !ok {
+		t.Errorf("expected the result of a call to be called, got %T", call.Callee)
+	}
+
+	// The function literal does not start a new statement after an error
+	tokens, err := lexer.Tokenize("main.smt", "let a = 1 + ) func(x) { };\nlet b = 2;")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ps := NewParser(tokens)
+	_ = ps.Parse()
+	if len(ps.Diagnostics) != 1 || len(ps.Nodes) != 1 {
+		t.Errorf("expected a single error and a statement, got %v %+v", ps.Diagnostics, ps.Nodes)
+	}
+}
+
+func TestParseTypeDecl(t *testing.T) {
+	nodes, err := parseSource(t, `type User { name, email }
+type Empty {}
+let t = type(user);`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decl, ok := nodes[0].(*TypeDecl)
+	if !ok || decl.Name != "User" || len(decl.Fields) != 2 || decl.Fields[1].Name != "email" {
+		t.Fatalf("unexpected type declaration: %+v", nodes[0])
+	}
+
+	if decl.Span.End.Pos != 26 || len(nodes[1].(*TypeDecl).Fields) != 0 {
+		t.Errorf("unexpected span or fields: %+v %+v", decl.Span, nodes[1])
+	}
+
+	if _, ok := nodes[2].(*VarDecl).Value.(*CallExpr); !ok {
+		t.Errorf("expected type() to be a call, got %+v", nodes[2])
+	}
+
+	tests := map[string]Err{
+		"type string { a }":             ErrorInvalidType,
+		"type User { a, a }":            ErrorInvalidField,
+		"type User { a b }":             ErrorUnexpectedToken,
+		"let User = 1; type User { a }": ErrorCannotReDeclareVar,
+		"func f() { type User { a } }":  ErrorInvalidStatement,
+		"if true { type User { a } }":   ErrorInvalidStatement,
+	}
+
+	for src, want := range tests {
+		_, err := parseSource(t, src)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseModules(t *testing.T) {
+	nodes, err := parseSource(t, `use "./lib/users.smt" as users;
+use 'lib/greet.smt';
+use io;
+export const limit = 10;
+export func find(id) { return id; }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	use := nodes[0].(*UseStmt)
+	if use.Path != "./lib/users.smt" || use.Alias != "users" || use.Package != "" {
+		t.Errorf("unexpected module use: %+v", use)
+	}
+
+	if use := nodes[1].(*UseStmt); use.Path != "lib/greet.smt" || use.Alias != "greet" {
+		t.Errorf("expected the file name as the alias, got %+v", use)
+	}
+
+	if use := nodes[2].(*UseStmt); use.Path != "" || use.Package != "io" {
+		t.Errorf("unexpected package use: %+v", use)
+	}
+
+	decl := nodes[3].(*VarDecl)
+	if !decl.Export || !decl.Const || decl.Span.Start.Pos != 1 {
+		t.Errorf("unexpected exported constant: %+v", decl)
+	}
+
+	if fn := nodes[4].(*FuncDecl); !fn.Export || fn.Name != "find" {
+		t.Errorf("unexpected exported function: %+v", fn)
+	}
+
+	tests := map[string]Err{
+		`use "lib/my-users.smt";`:         ErrorInvalidStatement,
+		`func f() { use "users.smt"; }`:   ErrorInvalidStatement,
+		`export let x = 1;`:               ErrorInvalidStatement,
+		`if true { export const x = 1; }`: ErrorInvalidStatement,
+		`export func User#greet(u) { }`:   ErrorInvalidStatement,
+		`use 12;`:                         ErrorUnexpectedToken,
+	}
+
+	for src, want := range tests {
+		_, err := parseSource(t, src)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
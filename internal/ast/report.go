@@ -0,0 +1,292 @@
+package ast
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/fatih/color"
+)
+
+// maxSnippetLines is the number of source lines shown of a longer span
+const maxSnippetLines = 3
+
+// Frame is a function call of a stack trace. Pos is where the function was called.
+type Frame struct {
+	Name string       `json:"name" yaml:"name"`
+	Pos  NodeFileInfo `json:"pos" yaml:"pos"`
+}
+
+// Report is an error prepared to be shown to the user: the message,
+// the source code it is about, a hint and the function calls that led to it
+type Report struct {
+	Severity Severity `json:"severity"`
+	Code     string   `json:"code,omitempty"`
+	Message  string   `json:"message"`
+	Span     *Span    `json:"span,omitempty"`
+	Hint     string   `json:"hint,omitempty"`
+	// Stack holds the innermost call first
+	Stack []Frame `json:"stack,omitempty"`
+}
+
+// Reporter is implemented by the errors that know their position
+type Reporter interface {
+	Report() Report
+}
+
+// Reports returns the reports of an error. Diagnostics have a report for
+// each of them, errors without a position have a report with the message only.
+func Reports(err error) []Report {
+	var diags Diagnostics
+	if errors.As(err, &diags) {
+		reports := make([]Report, len(diags))
+		for i, d := range diags {
+			reports[i] = d.Report()
+		}
+		return reports
+	}
+
+	var r Reporter
+	if errors.As(err, &r) {
+		return []Report{r.Report()}
+	}
+
+	var lexErr *lexer.Error
+	if errors.As(err, &lexErr) {
+		pos := NodeFileInfo{File: lexErr.File, Line: lexErr.Line, Pos: lexErr.Pos}
+		return []Report{{
+			Severity: SeverityError,
+			Code:     string(ErrorInvalidToken),
+			Message:  lexErr.Msg,
+			Span:     &Span{Start: pos, End: pos},
+			Hint:     tokenHint(lexErr.Msg),
+		}}
+	}
+
+	return []Report{{Severity: SeverityError, Message: err.Error()}}
+}
+
+// Render renders an error for the terminal, or as plain text if colored is false
+func Render(err error, colored bool) string {
+	reports := Reports(err)
+
+	rendered := make([]string, len(reports))
+	for i, r := range reports {
+		rendered[i] = r.Render(colored)
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// Render renders the report like this:
+//
+//	error[unexpected token]: expected ';', got 'let'
+//	 --> main.smt:1:10
+//	  |
+//	1 | let a = 1
+//	  |          ^
+//	  = hint: check for a missing ';', ',' or closing bracket before it
+func (r Report) Render(colored bool) string {
+	paint := func(attrs ...color.Attribute) func(a ...interface{}) string {
+		c := color.New(attrs...)
+		if colored {
+			c.EnableColor()
+		} else {
+			c.DisableColor()
+		}
+		return c.SprintFunc()
+	}
+
+	accent := paint(color.FgRed, color.Bold)
+	if r.Severity == SeverityWarning {
+		accent = paint(color.FgYellow, color.Bold)
+	}
+	blue := paint(color.FgBlue, color.Bold)
+	bold := paint(color.Bold)
+
+	severity := r.Severity
+	if severity == "" {
+		severity = SeverityError
+	}
+
+	var sb strings.Builder
+	title := string(severity)
+	if r.Code != "" {
+		title += "[" + r.Code + "]"
+	}
+	fmt.Fprintf(&sb, "%s%s\n", accent(title), bold(": "+r.Message))
+
+	if r.Span == nil || r.Span.Start.File == "" {
+		r.writeStack(&sb, blue)
+		return sb.String()
+	}
+	start := r.Span.Start
+
+	lines := sourceLines(start.File, start.Line, r.Span.End.Line)
+	gutter := strings.Repeat(" ", len(fmt.Sprint(start.Line+max(len(lines)-1, 0))))
+
+	fmt.Fprintf(&sb, "%s%s %s:%d:%d\n", gutter, blue("-->"), filepath.Clean(start.File), start.Line, start.Pos)
+
+	if len(lines) > 0 {
+		fmt.Fprintf(&sb, "%s %s\n", gutter, blue("|"))
+		for i, line := range lines {
+			num := start.Line + i
+			fmt.Fprintf(&sb, "%s %s %s\n", blue(fmt.Sprintf("%*d", len(gutter), num)), blue("|"), line)
+
+			if marker := r.marker(line, num); marker != "" {
+				fmt.Fprintf(&sb, "%s %s %s\n", gutter, blue("|"), accent(marker))
+			}
+		}
+	}
+
+	if r.Hint != "" {
+		fmt.Fprintf(&sb, "%s %s %s\n", gutter, blue("="), bold("hint: ")+r.Hint)
+	}
+
+	r.writeStack(&sb, blue)
+	return sb.String()
+}
+
+// marker returns the carets under the part of the line that is in the span
+func (r Report) marker(line string, num int) string {
+	runes := []rune(line)
+
+	// The lines after the first one are marked from their indentation
+	from, to := len(runes)-len([]rune(strings.TrimLeft(line, " \t")))+1, len(runes)+1
+	if num == r.Span.Start.Line {
+		from = r.Span.Start.Pos
+	}
+	if num == r.Span.End.Line {
+		to = r.Span.End.Pos
+	}
+
+	if from > len(runes)+1 {
+		return ""
+	}
+	if to <= from {
+		to = from + 1
+	}
+
+	// Tabs are kept, so the carets line up with the source
+	var sb strings.Builder
+	for i := 0; i < from-1; i++ {
+		if runes[i] == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+	}
+	sb.WriteString(strings.Repeat("^", to-from))
+
+	return sb.String()
+}
+
+func (r Report) writeStack(sb *strings.Builder, blue func(a ...interface{}) string) {
+	if len(r.Stack) == 0 {
+		return
+	}
+
+	sb.WriteString(blue("stack trace:") + "\n")
+	for _, f := range r.Stack {
+		// The main function is called by the runtime
+		if f.Pos.File == "" {
+			fmt.Fprintf(sb, "  at %s()\n", f.Name)
+			continue
+		}
+		fmt.Fprintf(sb, "  at %s() called from %s:%d:%d\n", f.Name, filepath.Clean(f.Pos.File), f.Pos.Line, f.Pos.Pos)
+	}
+}
+
+// sourceLines returns the lines of the file from the first to the last one.
+// Long ranges are cut to maxSnippetLines lines.
+func sourceLines(file string, first, last int) []string {
+	b, err := os.ReadFile(file)
+	if err != nil || first < 1 {
+		return nil
+	}
+
+	lines := strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n")
+	if first > len(lines) {
+		return nil
+	}
+
+	last = min(max(last, first), len(lines), first+maxSnippetLines-1)
+	return lines[first-1 : last]
+}
+
+// Report returns the report of the diagnostic
+func (d Diagnostic) Report() Report {
+	span := d.Span
+
+	hint := d.Code.Hint()
+	if d.Code == ErrorInvalidToken {
+		hint = tokenHint(d.Message)
+	}
+	return Report{
+		Severity: d.Severity,
+		Code:     string(d.Code),
+		Message:  d.Message,
+		Span:     &span,
+		Hint:     hint,
+	}
+}
+
+// Render renders the diagnostic with its source code
+func (d Diagnostic) Render(colored bool) string {
+	return d.Report().Render(colored)
+}
+
+// Report returns the report of the error
+func (l ErrWithPos) Report() Report {
+	return NewDiagnostic(SeverityError, l).Report()
+}
+
+// Render renders the error with its source code
+func (l ErrWithPos) Render(colored bool) string {
+	return l.Report().Render(colored)
+}
+
+// hints are short suggestions on how to fix the errors of a code
+var hints = map[Err]string{
+	ErrorCannotReDeclareVar:  "use another name, or assign to the variable without let",
+	ErrorCannotReAssignConst: "declare it with let if its value has to change",
+	ErrorCannotUseBeforeDecl: "move the declaration before the first use",
+	ErrorUnexpectedToken:     "check for a missing ';', ',' or closing bracket before it",
+	ErrorUnexpectedEOF:       "the file ends in the middle of a statement, check for a missing '}' or ')'",
+	ErrorInvalidStatement:    "only declarations, assignments and calls can be statements",
+	ErrorInvalidFunction:     "functions are declared like func name(a, b) { }",
+	ErrorInvalidParameter:    "parameters are names separated by commas",
+	ErrorInvalidAssignment:   "only variables, list items, map keys and fields can be assigned",
+	ErrorInvalidCondition:    "write the condition between the keyword and the '{'",
+	ErrorInvalidLoop:         "loops are written like for let i = 0; i < n; i++ { } or for item in list { }",
+	ErrorInvalidBreak:        "break can only be used in the body of a loop",
+	ErrorInvalidContinue:     "continue can only be used in the body of a loop",
+	ErrorInvalidCall:         "only functions, methods and functions of packages can be called",
+	ErrorInvalidTemplate:     "template tags are {{ expr }}, {{ if }}, {{ for }}, {{ block }} and {{ end }}",
+	ErrorUnreachableCode:     "remove the code, or move it before the statement that leaves the block",
+}
+
+// Hint returns a suggestion on how to fix the error, or an empty string
+func (e Err) Hint() string {
+	return hints[e]
+}
+
+// tokenHints are the hints of the lexer errors by the start of their message
+var tokenHints = []struct{ prefix, hint string }{
+	{"unterminated", "check for an unterminated string, template or comment"},
+	{"invalid escape sequence", `use an escape sequence like \n, \t, \\, \xFF or \uFFFF`},
+	{"invalid number", "numbers are written like 42, 3.14 or 1e3"},
+	{"unexpected character", "remove the character, or write it in a string"},
+}
+
+// tokenHint returns the hint of a lexer error message, or an empty string
+func tokenHint(msg string) string {
+	for _, h := range tokenHints {
+		if strings.HasPrefix(msg, h.prefix) {
+			return h.hint
+		}
+	}
+	return ""
+}
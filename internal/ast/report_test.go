@@ -0,0 +1,131 @@
+package ast
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+)
+
+func TestReportRender(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.smt")
+	if err := os.WriteFile(file, []byte("let a = 1;\n\tlet b = a +* 2;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Report{
+		Code:    "unexpected token",
+		Message: "'*' in expression",
+		Span:    &Span{Start: NodeFileInfo{File: file, Line: 2, Pos: 13}, End: NodeFileInfo{File: file, Line: 2, Pos: 14}},
+		Hint:    "check the operators",
+		Stack:   []Frame{{Name: "f", Pos: NodeFileInfo{File: file, Line: 1, Pos: 1}}, {Name: "main"}},
+	}
+
+	want := strings.Join([]string{
+		"error[unexpected token]: '*' in expression",
+		" --> " + file + ":2:13",
+		"  |",
+		"2 | \tlet b = a +* 2;",
+		"  | \t           ^",
+		"  = hint: check the operators",
+		"stack trace:",
+		"  at f() called from " + file + ":1:1",
+		"  at main()",
+		"",
+	}, "\n")
+
+	if got := r.Render(false); got != want {
+		t.Errorf("unexpected plain report:\n%s\nwant:\n%s", got, want)
+	}
+
+	if colored := r.Render(true); !strings.Contains(colored, "\x1b[") {
+		t.Errorf("expected colors in the report, got:\n%s", colored)
+	}
+}
+
+func TestReportRenderSpan(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "main.smt")
+	if err := os.WriteFile(file, []byte("f(\n  1 +\n  2\n);\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := Report{
+		Message: "invalid argument",
+		Span:    &Span{Start: NodeFileInfo{File: file, Line: 2, Pos: 3}, End: NodeFileInfo{File: file, Line: 3, Pos: 4}},
+	}
+
+	got := r.Render(false)
+	for _, want := range []string{"2 |   1 +\n  |   ^^^\n", "3 |   2\n  |   ^\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %q in the report, got:\n%s", want, got)
+		}
+	}
+
+	// Errors of files that cannot be read only have their position
+	r.Span.Start.File = "missing.smt"
+	if got := r.Render(false); got != "error: invalid argument\n --> missing.smt:2:3\n" {
+		t.Errorf("unexpected report without source: %q", got)
+	}
+}
+
+func TestReports(t *testing.T) {
+	pos := NodeFileInfo{File: "main.smt", Line: 1, Pos: 5}
+	diags := Diagnostics{
+		NewDiagnostic(SeverityError, NewErrWithPos(pos, fmt.Errorf("%w: missing '}'", ErrorUnexpectedEOF))),
+		NewDiagnostic(SeverityWarning, NewErrWithPos(pos, fmt.Errorf("%w: the statements after return never run", ErrorUnreachableCode))),
+	}
+
+	reports := Reports(fmt.Errorf("parse main.smt: %w", diags))
+	if len(reports) != 2 {
+		t.Fatalf("expected a report for each diagnostic, got %+v", reports)
+	}
+
+	if r := reports[0]; r.Code != string(ErrorUnexpectedEOF) || r.Message != "missing '}'" || r.Span.Start != pos || r.Hint == "" {
+		t.Errorf("unexpected error report: %+v", r)
+	}
+
+	if reports[1].Severity != SeverityWarning {
+		t.Errorf("expected a warning, got %+v", reports[1])
+	}
+
+	b, err := json.Marshal(Reports(errors.New("boom")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `[{"severity":"error","message":"boom"}]` {
+		t.Errorf("unexpected JSON report: %s", b)
+	}
+}
+
+func TestTokenHints(t *testing.T) {
+	tests := map[string]string{
+		`let a = "abc;`:  "check for an unterminated string, template or comment",
+		`let a = 1_000;`: "numbers are written like 42, 3.14 or 1e3",
+		`let a = "\q";`:  `use an escape sequence like \n, \t, \\, \xFF or \uFFFF`,
+		"let a = 1 ` 2;": "remove the character, or write it in a string",
+	}
+
+	for src, want := range tests {
+		_, err := lexer.Tokenize("main.smt", src)
+		if err == nil {
+			t.Errorf("%s: expected an error", src)
+			continue
+		}
+
+		if r := Reports(err); r[0].Hint != want {
+			t.Errorf("%s: expected hint %q, got %q", src, want, r[0].Hint)
+		}
+	}
+
+	// Expressions of templates are reported as diagnostics
+	_, err := ParseExpressionAt("1_000", NodeFileInfo{File: "main.smt", Line: 1, Pos: 1})
+	if r := Reports(err); len(r) != 1 || r[0].Hint != tests[`let a = 1_000;`] {
+		t.Errorf("unexpected report: %+v", r)
+	}
+}
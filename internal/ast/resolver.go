@@ -0,0 +1,270 @@
+package ast
+
+import "fmt"
+
+// resolver checks the variables of a parsed file in their lexical scopes.
+// Every block is a scope, like the bodies of functions, ifs and loops.
+// A variable is used before its declaration if no declaration is visible
+// at the use, but the enclosing blocks of the function declare it later.
+// Uses in a nested function are only resolved when it is called, so the
+// variables declared after the function can be used in it.
+type resolver struct {
+	scope  *scope
+	report func(err error)
+}
+
+type scope struct {
+	parent *scope
+	// fn is set for the scope of a function body
+	fn   bool
+	vars map[string]*binding
+}
+
+// binding is a variable of a scope. The variables of a block are known
+// before its statements are resolved, declared is set at their declaration.
+type binding struct {
+	info     NodeFileInfo
+	constant bool
+	declared bool
+}
+
+func (r *resolver) push(fn bool) {
+	r.scope = &scope{parent: r.scope, fn: fn, vars: make(map[string]*binding)}
+}
+
+func (r *resolver) pop() {
+	r.scope = r.scope.parent
+}
+
+// declare declares a variable of the current scope, like a parameter
+func (r *resolver) declare(name string, info NodeFileInfo, constant bool) {
+	r.scope.vars[name] = &binding{info: info, constant: constant, declared: true}
+}
+
+// lookup returns the declared variable visible at the current position.
+// If there is none, later is the variable the function declares later.
+func (r *resolver) lookup(name string) (b *binding, later *binding) {
+	inFunc := true
+	for s := r.scope; s != nil; s = s.parent {
+		if v, ok := s.vars[name]; ok {
+			if v.declared || !inFunc {
+				return v, nil
+			}
+
+			if later == nil {
+				later = v
+			}
+		}
+
+		if s.fn {
+			inFunc = false
+		}
+	}
+	return nil, later
+}
+
+func (r *resolver) resolveFile(nodes []Stmt) {
+	r.push(false)
+	r.resolveStmts(nodes)
+	r.pop()
+}
+
+func (r *resolver) resolveBlock(block *BlockStmt) {
+	r.push(false)
+	r.resolveStmts(block.Stmts)
+	r.pop()
+}
+
+// resolveFunc resolves the body of a function in a new function scope
+func (r *resolver) resolveFunc(params []*Param, body *BlockStmt) {
+	r.push(true)
+	for _, param := range params {
+		r.declare(param.Name, param.Info, false)
+	}
+	r.resolveStmts(body.Stmts)
+	r.pop()
+}
+
+func (r *resolver) resolveStmts(stmts []Stmt) {
+	for _, stmt := range stmts {
+		if decl := varDecl(stmt); decl != nil {
+			r.scope.vars[decl.Name] = &binding{info: decl.Info, constant: decl.Const}
+		}
+	}
+
+	for _, stmt := range stmts {
+		r.resolveStmt(stmt)
+	}
+}
+
+// varDecl returns the variable declaration of a statement if it has one
+func varDecl(stmt Stmt) *VarDecl {
+	if catch, ok := stmt.(*CatchStmt); ok {
+		stmt = catch.Stmt
+	}
+
+	decl, _ := stmt.(*VarDecl)
+	return decl
+}
+
+func (r *resolver) resolveStmt(stmt Stmt) {
+	switch s := stmt.(type) {
+	case *VarDecl:
+		if s.Value != nil {
+			r.resolveExpr(s.Value)
+		}
+
+		if b, ok := r.scope.vars[s.Name]; ok {
+			b.declared = true
+		} else {
+			r.declare(s.Name, s.Info, s.Const)
+		}
+	case *AssignStmt:
+		r.resolveExpr(s.Value)
+		r.resolveAssign(s.Target)
+	case *ExprStmt:
+		r.resolveExpr(s.Expr)
+	case *CatchStmt:
+		r.resolveStmt(s.Stmt)
+
+		// The error is stored in the variable of the current scope
+		b, ok := r.scope.vars[s.Name]
+		switch {
+		case !ok:
+			r.declare(s.Name, s.Info, false)
+		case b.constant:
+			r.report(NewErrWithSpan(Span{Start: s.Info, End: s.Span.End}, fmt.Errorf("%w: '%s' cannot store the error of @%s", ErrorCannotReAssignConst, s.Name, s.Name)))
+		}
+	case *ReturnStmt:
+		if s.Value != nil {
+			r.resolveExpr(s.Value)
+		}
+	case *FuncDecl:
+		r.resolveFunc(s.Params, s.Body)
+	case *ComponentDecl:
+		r.resolveFunc(s.Params, s.Body)
+	case *BlockStmt:
+		r.resolveBlock(s)
+	case *IfStmt:
+		r.resolveExpr(s.Cond)
+		r.resolveBlock(s.Then)
+		if s.Else != nil {
+			r.resolveStmt(s.Else)
+		}
+	case *WhileStmt:
+		r.resolveExpr(s.Cond)
+		r.resolveBlock(s.Body)
+	case *ForStmt:
+		r.push(false)
+		if s.Init != nil {
+			r.resolveStmts([]Stmt{s.Init})
+		}
+		if s.Cond != nil {
+			r.resolveExpr(s.Cond)
+		}
+		if s.Post != nil {
+			r.resolveStmt(s.Post)
+		}
+		r.resolveBlock(s.Body)
+		r.pop()
+	case *ForInStmt:
+		r.resolveExpr(s.Collection)
+		r.push(false)
+		for _, v := range s.Vars {
+			r.declare(v.Name, v.Info, false)
+		}
+		r.resolveBlock(s.Body)
+		r.pop()
+	}
+}
+
+// resolveAssign checks the target of an assignment, constants cannot be reassigned
+func (r *resolver) resolveAssign(target Expr) {
+	ident, ok := target.(*IdentExpr)
+	if !ok {
+		r.resolveExpr(target)
+		return
+	}
+
+	if b := r.resolveIdent(ident); b != nil && b.constant {
+		r.report(NewErrWithSpan(ident.Span, fmt.Errorf("%w: '%s'", ErrorCannotReAssignConst, ident.Name)))
+	}
+}
+
+// resolveIdent returns the variable of the identifier, nil if it is not a
+// variable of the file, like a function, a package or a global of the runtime
+func (r *resolver) resolveIdent(ident *IdentExpr) *binding {
+	b, later := r.lookup(ident.Name)
+	if b == nil && later != nil {
+		r.report(NewErrWithSpan(ident.Span, fmt.Errorf("%w: '%s' is declared on line %d", ErrorCannotUseBeforeDecl, ident.Name, later.info.Line)))
+	}
+	return b
+}
+
+func (r *resolver) resolveExpr(e Expr) {
+	switch e := e.(type) {
+	case *IdentExpr:
+		r.resolveIdent(e)
+	case *LiteralExpr:
+		r.resolveTemplate(e.Template)
+	case *MemberExpr:
+		r.resolveExpr(e.Object)
+	case *CallExpr:
+		r.resolveExpr(e.Callee)
+		for _, arg := range e.Args {
+			r.resolveExpr(arg)
+		}
+	case *IndexExpr:
+		r.resolveExpr(e.Object)
+		r.resolveExpr(e.Index)
+	case *ListExpr:
+		for _, item := range e.Items {
+			r.resolveExpr(item)
+		}
+	case *MapExpr:
+		for i := range e.Keys {
+			r.resolveExpr(e.Keys[i])
+			r.resolveExpr(e.Values[i])
+		}
+	case *UnaryExpr:
+		r.resolveExpr(e.Operand)
+	case *BinaryExpr:
+		r.resolveExpr(e.Left)
+		r.resolveExpr(e.Right)
+	case *FuncExpr:
+		r.resolveFunc(e.Params, e.Body)
+	}
+}
+
+// resolveTemplate resolves the expressions of a template,
+// the variables of a for block are declared in its own scope
+func (r *resolver) resolveTemplate(nodes []TemplateNode) {
+	for _, node := range nodes {
+		if node.Expr != nil {
+			r.resolveExpr(node.Expr)
+		}
+
+		for _, filter := range node.Filters {
+			for _, arg := range filter.Args {
+				r.resolveExpr(arg)
+			}
+		}
+
+		for _, attr := range node.Attrs {
+			r.resolveTemplate(attr.Value)
+		}
+
+		if node.Kind == TemplateFor {
+			r.push(false)
+			for _, v := range node.Vars {
+				r.declare(v, node.Info, false)
+			}
+			r.resolveTemplate(node.Children)
+			r.pop()
+		} else {
+			r.resolveTemplate(node.Children)
+		}
+
+		r.resolveTemplate(node.Else)
+	}
+}
@@ -0,0 +1,105 @@
+package ast
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/lexer"
+)
+
+func TestResolveValid(t *testing.T) {
+	srcs := []string{
+		// Shadowing in a block
+		`const x = 1; if true { let x = 2; x = 3; }`,
+		// Functions see the variables declared after them
+		`func f() { return limit; } const limit = 1; f();`,
+		`let fact = func(n) { return fact(n - 1); };`,
+		// Functions and packages are not variables
+		`out.write(f()); func f() { return 1; }`,
+		// Loop variables and the err of the @err macro
+		`for let i = 0; i < 3; i++ { out.write(i); }`,
+		`for k, v in {"a": 1} { out.write(k, v); }`,
+		`let a = 10 / 0 @err; out.write(err, a);`,
+		`const err = 1; if true { out.write(1) @err; }`,
+		`let t = <>{{ for i, user in users }}{{ i }}{{ end }}</>;`,
+		// A use before the declaration in a block resolves to the outer variable
+		`let x = 1; if true { out.write(x); let x = 2; }`,
+	}
+
+	for _, src := range srcs {
+		if _, err := parseSource(t, src); err != nil {
+			t.Errorf("%s: unexpected error: %v", src, err)
+		}
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	tests := map[string]Err{
+		`const x = 1; x = 2;`:                               ErrorCannotReAssignConst,
+		`const x = 1; x++;`:                                 ErrorCannotReAssignConst,
+		`const x = 1; if true { x = 2; }`:                   ErrorCannotReAssignConst,
+		`const x = 1; for let i = 0; i < 1; i++ { x = i; }`: ErrorCannotReAssignConst,
+		`func f() { limit = 2; } const limit = 1;`:          ErrorCannotReAssignConst,
+		`let f = func() { const y = 1; y = 2; };`:           ErrorCannotReAssignConst,
+		`out.write(x); let x = 1;`:                          ErrorCannotUseBeforeDecl,
+		`x = 2; let x = 1;`:                                 ErrorCannotUseBeforeDecl,
+		`if true { out.write(x); } let x = 1;`:              ErrorCannotUseBeforeDecl,
+		`func f() { out.write(y); let y = 1; }`:             ErrorCannotUseBeforeDecl,
+		`let t = <>{{ name }}</>; let name = "John";`:       ErrorCannotUseBeforeDecl,
+		`let x = x + 1;`:                                    ErrorCannotUseBeforeDecl,
+		`const err = 1; out.write(1) @err;`:                 ErrorCannotReAssignConst,
+	}
+
+	for src, want := range tests {
+		_, err := parseSource(t, src)
+		if !errors.Is(err, want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestResolveDiagnostics(t *testing.T) {
+	tokens, err := lexer.Tokenize("main.smt", "const a = 1;\nout.write(b);\nlet b = 2;\na = b;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(tokens)
+	if err := p.Parse(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if len(p.Diagnostics) != 2 {
+		t.Fatalf("expected 2 diagnostics, got %d: %v", len(p.Diagnostics), p.Diagnostics)
+	}
+
+	use, assign := p.Diagnostics[0], p.Diagnostics[1]
+	if use.Code != ErrorCannotUseBeforeDecl || use.Span.Start.Line != 2 || use.Span.Start.Pos != 11 || use.Span.End.Pos != 12 {
+		t.Errorf("unexpected use diagnostic: %+v", use)
+	}
+
+	if use.Message != "'b' is declared on line 3" {
+		t.Errorf("unexpected message: %q", use.Message)
+	}
+
+	if assign.Code != ErrorCannotReAssignConst || assign.Span.Start.Line != 4 {
+		t.Errorf("unexpected assignment diagnostic: %+v", assign)
+	}
+}
+
+func TestDiagnosticsOrder(t *testing.T) {
+	tokens, err := lexer.Tokenize("main.smt", "out.write(b);\nlet b = 1;\nlet = 2;\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewParser(tokens)
+	if err := p.Parse(); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	// The resolver runs after the parser, its diagnostics are sorted in
+	if len(p.Diagnostics) != 2 || p.Diagnostics[0].Code != ErrorCannotUseBeforeDecl || p.Diagnostics[1].Span.Start.Line != 3 {
+		t.Errorf("unexpected diagnostics: %+v", p.Diagnostics)
+	}
+}
@@ -0,0 +1,649 @@
+package ast
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type TemplateKind int
+
+const (
+	// TemplateText is a static part of the template
+	TemplateText TemplateKind = iota
+	// TemplateExpr is an interpolated expression: {{ expr }}
+	TemplateExpr
+	// TemplateIf is a conditional block: {{ if cond }} ... {{ else }} ... {{ end }}
+	TemplateIf
+	// TemplateFor is a loop block: {{ for key, value in collection }} ... {{ end }}
+	TemplateFor
+	// TemplateBlock is a named block that extending templates can override:
+	// {{ block content }} ... {{ end }}
+	TemplateBlock
+	// TemplateComponent is a component used as a tag: <Card title="{{ t }}">...</Card>
+	TemplateComponent
+	// TemplateSlot is named content of a component: <Slot name="footer">...</Slot>
+	TemplateSlot
+)
+
+// TemplateNode is a node of a compiled template tree. Templates are compiled
+// when the code is parsed, rendering them only evaluates the expressions.
+type TemplateNode struct {
+	Kind TemplateKind `json:"kind" yaml:"kind"`
+	// Content is the static text, the expression, the condition,
+	// the collection of a for block or the name of a block, component or slot
+	Content string `json:"content" yaml:"content"`
+	// Expr is the compiled expression, condition or collection
+	Expr Expr         `json:"expr,omitempty" yaml:"expr,omitempty"`
+	Info NodeFileInfo `json:"info" yaml:"info"`
+	// Vars are the loop variables of a for block
+	Vars     []string       `json:"vars,omitempty" yaml:"vars,omitempty"`
+	Children []TemplateNode `json:"children,omitempty" yaml:"children,omitempty"`
+	// Else is the else branch of an if block, an else-if is a single if node
+	Else []TemplateNode `json:"else,omitempty" yaml:"else,omitempty"`
+	// Filters format the value of an expression: {{ value | upper }}
+	Filters []TemplateFilter `json:"filters,omitempty" yaml:"filters,omitempty"`
+	// Attrs are the props of a component
+	Attrs []TemplateAttr `json:"attrs,omitempty" yaml:"attrs,omitempty"`
+}
+
+// TemplateAttr is an attribute of a component tag. The value is made of
+// texts and expressions, it is nil for attributes without a value.
+type TemplateAttr struct {
+	Name  string         `json:"name" yaml:"name"`
+	Info  NodeFileInfo   `json:"info" yaml:"info"`
+	Value []TemplateNode `json:"value" yaml:"value"`
+}
+
+// TemplateFilter is a filter name or a call with arguments: truncate(40)
+type TemplateFilter struct {
+	Name string `json:"name" yaml:"name"`
+	Args []Expr `json:"args,omitempty" yaml:"args,omitempty"`
+	// Expr is the filter as it is written, errors of the filter are reported at it
+	Expr Expr `json:"expr" yaml:"expr"`
+}
+
+var (
+	templateTagRegex  = regexp.MustCompile(`\{\{(.*?)}}`)
+	templateForRegex  = regexp.MustCompile(`^([a-zA-Z_]\w*)(?:\s*,\s*([a-zA-Z_]\w*))?\s+in\s+`)
+	templateNameRegex = regexp.MustCompile(`^[a-zA-Z_][\w-]*$`)
+	// Component names start with an uppercase and a lowercase letter,
+	// so uppercase HTML tags like <BR> are not components
+	componentTagRegex  = regexp.MustCompile(`</?([A-Z][a-z]\w*)[\s/>]`)
+	componentAttrRegex = regexp.MustCompile(`^[a-zA-Z_][\w-]*`)
+)
+
+// templatePart is a static text or the content of a {{ }} tag
+type templatePart struct {
+	static  bool
+	content string
+	offset  int
+}
+
+type templateParser struct {
+	src   string
+	info  NodeFileInfo
+	parts []templatePart
+	inx   int
+}
+
+// ParseTemplate compiles the template into a tree of static texts,
+// expressions and blocks. The info is the position of the first
+// character of the template, the errors are positioned inside of it.
+func ParseTemplate(s string, info NodeFileInfo) ([]TemplateNode, error) {
+	p := &templateParser{src: s, info: info}
+
+	lastIndex := 0
+	for _, match := range templateTagRegex.FindAllStringSubmatchIndex(s, -1) {
+		if match[0] > lastIndex {
+			p.parts = append(p.parts, templatePart{static: true, content: s[lastIndex:match[0]], offset: lastIndex})
+		}
+
+		raw := s[match[2]:match[3]]
+		p.parts = append(p.parts, templatePart{
+			content: strings.TrimSpace(raw),
+			offset:  match[2] + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace)),
+		})
+
+		lastIndex = match[1]
+	}
+
+	if lastIndex < len(s) {
+		p.parts = append(p.parts, templatePart{static: true, content: s[lastIndex:], offset: lastIndex})
+	}
+
+	nodes, end, err := p.parseBlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if end != nil {
+		return nil, p.errorf(*end, "unexpected %s", end)
+	}
+
+	if err := p.checkSlots(nodes, false); err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
+
+func (part templatePart) String() string {
+	if part.static {
+		return part.content
+	}
+	return "{{ " + part.content + " }}"
+}
+
+// parseBlock parses the nodes until an {{ else }}, an {{ end }}, a closing
+// component tag or the end of the template. It returns the part that ended the block.
+func (p *templateParser) parseBlock() ([]TemplateNode, *templatePart, error) {
+	var nodes []TemplateNode
+
+	for p.inx < len(p.parts) {
+		part := p.parts[p.inx]
+
+		if part.static {
+			match := componentTagRegex.FindStringSubmatchIndex(part.content)
+			if match == nil {
+				nodes = append(nodes, TemplateNode{Kind: TemplateText, Content: part.content, Info: p.pos(part.offset)})
+				p.inx++
+				continue
+			}
+
+			// The text before the tag, the tag is parsed in the next iteration
+			if match[0] > 0 {
+				nodes = append(nodes, TemplateNode{Kind: TemplateText, Content: part.content[:match[0]], Info: p.pos(part.offset)})
+				p.consume(match[0])
+				continue
+			}
+
+			name := part.content[match[2]:match[3]]
+			if part.content[1] == '/' {
+				end := strings.IndexByte(part.content, '>')
+				if end < 0 || strings.TrimSpace(part.content[match[3]:end]) != "" {
+					return nil, nil, p.errorf(part, "invalid closing tag of component %s", name)
+				}
+
+				p.consume(end + 1)
+				return nodes, &templatePart{static: true, content: "</" + name + ">", offset: part.offset}, nil
+			}
+
+			node, err := p.parseComponent(name)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node)
+			continue
+		}
+
+		p.inx++
+
+		keyword, rest, restOffset := splitKeyword(part)
+		switch keyword {
+		case "end", "else":
+			if keyword == "end" && rest != "" {
+				return nil, nil, p.errorf(part, "unexpected {{ %s }}", part.content)
+			}
+			return nodes, &part, nil
+		case "if":
+			node, err := p.parseIf(part, rest, restOffset)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node)
+		case "for":
+			node, err := p.parseFor(part, rest, restOffset)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node)
+		case "block":
+			node, err := p.parseNamedBlock(part, rest)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node)
+		default:
+			node, err := p.parsePipes(part)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes, nil, nil
+}
+
+// parseIf parses the body of an if block with its else and else-if branches
+func (p *templateParser) parseIf(start templatePart, condition string, offset int) (TemplateNode, error) {
+	if condition == "" {
+		return TemplateNode{}, p.errorf(start, "if block requires a condition")
+	}
+
+	expr, err := ParseExpressionAt(condition, p.pos(offset))
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	node := TemplateNode{Kind: TemplateIf, Content: condition, Expr: expr, Info: p.pos(offset)}
+
+	children, end, err := p.parseBlock()
+	if err != nil {
+		return TemplateNode{}, err
+	}
+	node.Children = children
+
+	if end == nil {
+		return TemplateNode{}, p.errorf(start, "missing {{ end }} of if block")
+	}
+
+	keyword, rest, restOffset := splitKeyword(*end)
+	if end.static {
+		return TemplateNode{}, p.errorf(*end, "unexpected %s in if block", end)
+	}
+
+	if keyword == "end" {
+		return node, nil
+	}
+
+	if rest != "" {
+		// else if cond: the rest of the chain is a nested if block
+		elseKeyword, condition, condOffset := splitKeyword(templatePart{content: rest, offset: restOffset})
+		if elseKeyword != "if" {
+			return TemplateNode{}, p.errorf(*end, "unexpected %s", end)
+		}
+
+		elseIf, err := p.parseIf(*end, condition, condOffset)
+		if err != nil {
+			return TemplateNode{}, err
+		}
+
+		node.Else = []TemplateNode{elseIf}
+		return node, nil
+	}
+
+	elseNodes, elseEnd, err := p.parseBlock()
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	if elseEnd == nil {
+		return TemplateNode{}, p.errorf(*end, "missing {{ end }} of else block")
+	}
+
+	if k, _, _ := splitKeyword(*elseEnd); elseEnd.static || k != "end" {
+		return TemplateNode{}, p.errorf(*elseEnd, "unexpected %s after else", elseEnd)
+	}
+
+	node.Else = elseNodes
+	return node, nil
+}
+
+// parseFor parses a loop block: {{ for item in items }} ... {{ end }}
+func (p *templateParser) parseFor(start templatePart, header string, offset int) (TemplateNode, error) {
+	match := templateForRegex.FindStringSubmatch(header)
+	if match == nil || len(header) == len(match[0]) {
+		return TemplateNode{}, p.errorf(start, "for block expects 'for item in collection'")
+	}
+
+	offset += len(match[0])
+	expr, err := ParseExpressionAt(header[len(match[0]):], p.pos(offset))
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	node := TemplateNode{
+		Kind:    TemplateFor,
+		Content: header[len(match[0]):],
+		Expr:    expr,
+		Info:    p.pos(offset),
+		Vars:    []string{match[1]},
+	}
+
+	if match[2] != "" {
+		if match[2] == match[1] {
+			return TemplateNode{}, p.errorf(start, "%v: '%s'", ErrorCannotReDeclareVar, match[2])
+		}
+		node.Vars = append(node.Vars, match[2])
+	}
+
+	children, end, err := p.parseBlock()
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	if end == nil {
+		return TemplateNode{}, p.errorf(start, "missing {{ end }} of for block")
+	}
+
+	if k, _, _ := splitKeyword(*end); end.static || k != "end" {
+		return TemplateNode{}, p.errorf(*end, "unexpected %s in for block", end)
+	}
+
+	node.Children = children
+	return node, nil
+}
+
+// parsePipes splits an interpolation into the expression and its filters
+// at the single | characters outside of strings, parentheses and brackets.
+func (p *templateParser) parsePipes(part templatePart) (TemplateNode, error) {
+	var (
+		node  = TemplateNode{Kind: TemplateExpr}
+		start int
+		depth int
+		quote byte
+	)
+
+	s := part.content
+	for i := 0; i <= len(s); i++ {
+		if i < len(s) {
+			c := s[i]
+
+			switch {
+			case quote != 0:
+				if c == '\\' {
+					i++
+				} else if c == quote {
+					quote = 0
+				}
+				continue
+			case c == '"' || c == '\'':
+				quote = c
+				continue
+			case c == '(' || c == '[' || c == '{':
+				depth++
+				continue
+			case c == ')' || c == ']' || c == '}':
+				depth--
+				continue
+			case c != '|' || depth > 0:
+				continue
+			case i+1 < len(s) && s[i+1] == '|':
+				i++ // Skip the || operator
+				continue
+			}
+		}
+
+		raw := s[start:i]
+		content := strings.TrimSpace(raw)
+		info := p.pos(part.offset + start + len(raw) - len(strings.TrimLeftFunc(raw, unicode.IsSpace)))
+		start = i + 1
+
+		expr, err := ParseExpressionAt(content, info)
+		if err != nil {
+			return TemplateNode{}, err
+		}
+
+		if node.Expr == nil {
+			node.Content, node.Expr, node.Info = content, expr, info
+			continue
+		}
+
+		filter, err := parseFilter(content, expr)
+		if err != nil {
+			return TemplateNode{}, err
+		}
+		node.Filters = append(node.Filters, filter)
+	}
+
+	return node, nil
+}
+
+// parseFilter parses a filter name or a call: truncate(40)
+func parseFilter(content string, expr Expr) (TemplateFilter, error) {
+	filter := TemplateFilter{Expr: expr}
+	if call, ok := expr.(*CallExpr); ok {
+		expr, filter.Args = call.Callee, call.Args
+	}
+
+	ident, ok := expr.(*IdentExpr)
+	if !ok {
+		return TemplateFilter{}, NewErrWithPos(filter.Expr.Pos(), fmt.Errorf("%w: invalid filter '%s'", ErrorInvalidTemplate, content))
+	}
+
+	filter.Name = ident.Name
+	return filter, nil
+}
+
+// parseNamedBlock parses a block that can be overridden: {{ block name }} ... {{ end }}
+func (p *templateParser) parseNamedBlock(start templatePart, name string) (TemplateNode, error) {
+	if !templateNameRegex.MatchString(name) {
+		return TemplateNode{}, p.errorf(start, "block expects a name, got '%s'", name)
+	}
+
+	children, end, err := p.parseBlock()
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	if end == nil {
+		return TemplateNode{}, p.errorf(start, "missing {{ end }} of block %s", name)
+	}
+
+	if k, _, _ := splitKeyword(*end); end.static || k != "end" {
+		return TemplateNode{}, p.errorf(*end, "unexpected %s in block %s", end, name)
+	}
+
+	return TemplateNode{Kind: TemplateBlock, Content: name, Info: p.pos(start.offset), Children: children}, nil
+}
+
+// parseComponent parses a component tag with its attributes and children.
+// The current part starts with the tag.
+func (p *templateParser) parseComponent(name string) (TemplateNode, error) {
+	start := p.parts[p.inx]
+	node := TemplateNode{Kind: TemplateComponent, Content: name, Info: p.pos(start.offset + 1)}
+	pos := 1 + len(name)
+
+	for {
+		part := p.parts[p.inx]
+		rest := strings.TrimLeftFunc(part.content[pos:], unicode.IsSpace)
+		pos = len(part.content) - len(rest)
+
+		if rest == "" {
+			p.inx++
+			if p.inx >= len(p.parts) {
+				return TemplateNode{}, p.errorf(start, "unclosed tag of component %s", name)
+			}
+
+			if !p.parts[p.inx].static {
+				return TemplateNode{}, p.errorf(p.parts[p.inx], "attributes of component %s expect quoted values", name)
+			}
+
+			pos = 0
+			continue
+		}
+
+		if strings.HasPrefix(rest, "/>") {
+			p.consume(pos + 2)
+			return p.componentNode(node)
+		}
+
+		if rest[0] == '>' {
+			p.consume(pos + 1)
+			break
+		}
+
+		attrName := componentAttrRegex.FindString(rest)
+		if attrName == "" {
+			return TemplateNode{}, p.errorf(templatePart{offset: part.offset + pos}, "invalid attribute of component %s", name)
+		}
+
+		attrOffset := part.offset + pos
+		attr := TemplateAttr{Name: attrName, Info: p.pos(attrOffset)}
+		pos += len(attrName)
+
+		value := strings.TrimLeftFunc(part.content[pos:], unicode.IsSpace)
+		if !strings.HasPrefix(value, "=") {
+			node.Attrs = append(node.Attrs, attr)
+			continue
+		}
+
+		value = strings.TrimLeftFunc(value[1:], unicode.IsSpace)
+		if value == "" || value[0] != '"' && value[0] != '\'' {
+			return TemplateNode{}, p.errorf(templatePart{offset: attrOffset}, "attribute %s of component %s expects a quoted value", attrName, name)
+		}
+
+		quote := value[0]
+		pos = len(part.content) - len(value) + 1
+		attr.Value = []TemplateNode{}
+
+		for {
+			part := p.parts[p.inx]
+			if part.static {
+				if end := strings.IndexByte(part.content[pos:], quote); end >= 0 {
+					if end > 0 {
+						attr.Value = append(attr.Value, TemplateNode{Kind: TemplateText, Content: part.content[pos : pos+end], Info: p.pos(part.offset + pos)})
+					}
+					pos += end + 1
+					break
+				}
+
+				if pos < len(part.content) {
+					attr.Value = append(attr.Value, TemplateNode{Kind: TemplateText, Content: part.content[pos:], Info: p.pos(part.offset + pos)})
+				}
+			} else {
+				if keyword, _, _ := splitKeyword(part); keyword != "" {
+					return TemplateNode{}, p.errorf(part, "unexpected {{ %s }} in attribute %s", keyword, attrName)
+				}
+				value, err := p.parsePipes(part)
+				if err != nil {
+					return TemplateNode{}, err
+				}
+				attr.Value = append(attr.Value, value)
+			}
+
+			p.inx++
+			pos = 0
+			if p.inx >= len(p.parts) {
+				return TemplateNode{}, p.errorf(templatePart{offset: attrOffset}, "unclosed value of attribute %s", attrName)
+			}
+		}
+
+		node.Attrs = append(node.Attrs, attr)
+	}
+
+	children, end, err := p.parseBlock()
+	if err != nil {
+		return TemplateNode{}, err
+	}
+
+	if end == nil {
+		return TemplateNode{}, p.errorf(start, "missing </%s>", name)
+	}
+
+	if end.content != "</"+name+">" {
+		return TemplateNode{}, p.errorf(*end, "unexpected %s in component %s", end, name)
+	}
+
+	node.Children = children
+	return p.componentNode(node)
+}
+
+// componentNode turns a parsed <Slot> tag into a slot node
+func (p *templateParser) componentNode(node TemplateNode) (TemplateNode, error) {
+	if node.Content != "Slot" {
+		return node, nil
+	}
+
+	if len(node.Attrs) != 1 || node.Attrs[0].Name != "name" || len(node.Attrs[0].Value) != 1 || node.Attrs[0].Value[0].Kind != TemplateText {
+		return TemplateNode{}, templateErrorf(node.Info, "slot expects a name: <Slot name=\"footer\">")
+	}
+
+	name := node.Attrs[0].Value[0].Content
+	if !templateNameRegex.MatchString(name) {
+		return TemplateNode{}, templateErrorf(node.Attrs[0].Info, "invalid slot name '%s'", name)
+	}
+
+	return TemplateNode{Kind: TemplateSlot, Content: name, Info: node.Info, Children: node.Children}, nil
+}
+
+// consume removes the first n bytes of the current static part
+func (p *templateParser) consume(n int) {
+	part := &p.parts[p.inx]
+	if n >= len(part.content) {
+		p.inx++
+		return
+	}
+
+	part.content = part.content[n:]
+	part.offset += n
+}
+
+// checkSlots makes sure that slots are the direct children of components
+// and that a component gets every slot once
+func (p *templateParser) checkSlots(nodes []TemplateNode, inComponent bool) error {
+	slots := make(map[string]bool)
+
+	for _, node := range nodes {
+		if node.Kind == TemplateSlot {
+			if !inComponent {
+				return templateErrorf(node.Info, "slot %s must be a direct child of a component", node.Content)
+			}
+
+			if slots[node.Content] {
+				return templateErrorf(node.Info, "slot %s is already set", node.Content)
+			}
+			slots[node.Content] = true
+		}
+
+		if err := p.checkSlots(node.Children, node.Kind == TemplateComponent); err != nil {
+			return err
+		}
+
+		if err := p.checkSlots(node.Else, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *templateParser) errorf(part templatePart, format string, args ...interface{}) error {
+	return templateErrorf(p.pos(part.offset), format, args...)
+}
+
+func templateErrorf(info NodeFileInfo, format string, args ...interface{}) error {
+	return NewErrWithPos(info, fmt.Errorf("%w: "+format, append([]interface{}{ErrorInvalidTemplate}, args...)...))
+}
+
+// pos returns the position of an offset of the template in the file
+func (p *templateParser) pos(offset int) NodeFileInfo {
+	return templatePos(p.src, offset, p.info)
+}
+
+// splitKeyword splits the block keyword from the rest of a tag.
+// Tags without a keyword return an empty keyword.
+func splitKeyword(part templatePart) (string, string, int) {
+	for _, keyword := range []string{"if", "else", "for", "block", "end"} {
+		if part.content == keyword {
+			return keyword, "", part.offset + len(keyword)
+		}
+
+		if strings.HasPrefix(part.content, keyword) && unicode.IsSpace(rune(part.content[len(keyword)])) {
+			rest := strings.TrimLeftFunc(part.content[len(keyword):], unicode.IsSpace)
+			return keyword, rest, part.offset + len(part.content) - len(rest)
+		}
+	}
+
+	return "", part.content, part.offset
+}
+
+// templatePos returns the position of the offset in a template,
+// the info is the position of the first character of the template.
+func templatePos(template string, offset int, info NodeFileInfo) NodeFileInfo {
+	before := template[:offset]
+
+	lines := strings.Count(before, "\n")
+	if lines == 0 {
+		info.Pos += utf8.RuneCountInString(before)
+		return info
+	}
+
+	info.Line += lines
+	info.Pos = utf8.RuneCountInString(before[strings.LastIndex(before, "\n")+1:]) + 1
+	return info
+}
@@ -0,0 +1,112 @@
+package ast
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseTemplateTree(t *testing.T) {
+	nodes, err := ParseTemplate(`<ul>{{ for i, user in users }}<li>{{ if user.admin }}A{{ else if i == 0 }}F{{ else }}{{ user.name }}{{ end }}</li>{{ end }}</ul>`, NodeFileInfo{Line: 1, Pos: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 3 || nodes[1].Kind != TemplateFor {
+		t.Fatalf("expected a for block between two texts, got %+v", nodes)
+	}
+
+	loop := nodes[1]
+	if loop.Content != "users" || strings.Join(loop.Vars, ",") != "i,user" || len(loop.Children) != 3 {
+		t.Fatalf("unexpected for block: %+v", loop)
+	}
+
+	cond := loop.Children[1]
+	if cond.Kind != TemplateIf || cond.Content != "user.admin" || len(cond.Else) != 1 {
+		t.Fatalf("unexpected if block: %+v", cond)
+	}
+
+	elseIf := cond.Else[0]
+	if elseIf.Kind != TemplateIf || elseIf.Content != "i == 0" || len(elseIf.Else) != 1 || elseIf.Else[0].Kind != TemplateExpr {
+		t.Fatalf("unexpected else-if block: %+v", elseIf)
+	}
+}
+
+func TestParseTemplateErrors(t *testing.T) {
+	tests := map[string]string{
+		`{{ if a }}x`:                             "missing {{ end }} of if block",
+		`{{ for a in b }}x`:                       "missing {{ end }} of for block",
+		`x{{ end }}`:                              "unexpected {{ end }}",
+		`{{ else }}`:                              "unexpected {{ else }}",
+		`{{ if }}{{ end }}`:                       "requires a condition",
+		`{{ for a b }}{{ end }}`:                  "expects 'for item in collection'",
+		`{{ for a, a in b }}{{ end }}`:            "cannot redeclare variable",
+		`{{ for a in b }}{{ else }}{{ end }}`:     "unexpected {{ else }} in for block",
+		`{{ if a }}{{ else }}{{ else }}{{ end }}`: "unexpected {{ else }} after else",
+	}
+
+	for src, want := range tests {
+		_, err := ParseTemplate(src, NodeFileInfo{Line: 1, Pos: 1})
+
+		var posErr ErrWithPos
+		if !errors.As(err, &posErr) || !strings.Contains(posErr.Err, want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseTemplateComponent(t *testing.T) {
+	nodes, err := ParseTemplate(`<p><Card title="{{ t | upper }}" note='a {{ b }} c' active>x<Slot name="footer">{{ f }}</Slot></Card><BR></p>`, NodeFileInfo{Line: 1, Pos: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(nodes) != 3 || nodes[1].Kind != TemplateComponent || nodes[2].Content != "<BR></p>" {
+		t.Fatalf("expected a component between two texts, got %+v", nodes)
+	}
+
+	card := nodes[1]
+	if card.Content != "Card" || len(card.Attrs) != 3 {
+		t.Fatalf("unexpected component: %+v", card)
+	}
+
+	if attr := card.Attrs[0]; attr.Name != "title" || len(attr.Value) != 1 || attr.Value[0].Content != "t" || len(attr.Value[0].Filters) != 1 {
+		t.Errorf("unexpected title attribute: %+v", attr)
+	}
+
+	if attr := card.Attrs[1]; attr.Name != "note" || len(attr.Value) != 3 {
+		t.Errorf("unexpected note attribute: %+v", attr)
+	}
+
+	if attr := card.Attrs[2]; attr.Name != "active" || attr.Value != nil {
+		t.Errorf("unexpected active attribute: %+v", attr)
+	}
+
+	if len(card.Children) != 2 || card.Children[1].Kind != TemplateSlot || card.Children[1].Content != "footer" {
+		t.Errorf("unexpected children: %+v", card.Children)
+	}
+}
+
+func TestParseTemplateComponentErrors(t *testing.T) {
+	tests := map[string]string{
+		`<Card>x`:                          "missing </Card>",
+		`<Card title="x">`:                 "missing </Card>",
+		`<Card title="x`:                   "unclosed value of attribute title",
+		`<Card title=x />`:                 "expects a quoted value",
+		`<Card {{ a }} />`:                 "expect quoted values",
+		`<Card>{{ if a }}</Card>{{ end }}`: "unexpected </Card> in if block",
+		`<Card></Badge>`:                   "unexpected </Badge> in component Card",
+		`</Card>`:                          "unexpected </Card>",
+		`<Slot name="a">x</Slot>`:          "slot a must be a direct child of a component",
+		`<Card><Slot>x</Slot></Card>`:      "slot expects a name",
+		`<Card><Slot name="a"></Slot><Slot name="a"></Slot></Card>`: "slot a is already set",
+		`<Card title="{{ if a }}" />`:                               "unexpected {{ if }} in attribute title",
+	}
+
+	for src, want := range tests {
+		_, err := ParseTemplate(src, NodeFileInfo{Line: 1, Pos: 1})
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
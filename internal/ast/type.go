@@ -10,20 +10,27 @@ const (
 	VarFloat        NodeType = "float"
 	VarBool         NodeType = "bool"
 	VarTemplate     NodeType = "template"
+	VarSafe         NodeType = "safe"
+	VarList         NodeType = "list"
+	VarMap          NodeType = "map"
 	VarVariable     NodeType = "variable"
+	VarFunc         NodeType = "func"
 
 	VarUnknown NodeType = "#unknown#"
-
-	FuncCall   NodeType = "func_call"
-	FuncDecl   NodeType = "func_decl"
-	FuncReturn NodeType = "func_return"
-
-	VarExpression NodeType = "expression"
-	VarOperator   NodeType = "operator"
-
-	UsePackage NodeType = "use_package"
-	Namespace  NodeType = "namespace"
-
-	ForLoop     NodeType = "for_loop"
-	IfStatement NodeType = "if_statement"
 )
+
+// builtinTypes are the types of the values that are not objects,
+// they cannot be the names of object types
+var builtinTypes = map[NodeType]bool{
+	VarNil:          true,
+	VarString:       true,
+	VarSingleString: true,
+	VarNumber:       true,
+	VarFloat:        true,
+	VarBool:         true,
+	VarTemplate:     true,
+	VarSafe:         true,
+	VarList:         true,
+	VarMap:          true,
+	VarFunc:         true,
+}
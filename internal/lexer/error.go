@@ -0,0 +1,28 @@
+package lexer
+
+import "fmt"
+
+// Error is a syntax error found while tokenizing a file
+type Error struct {
+	File string
+	Line int
+	Pos  int
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s at line %d, pos %d", e.Msg, e.Line, e.Pos)
+}
+
+func (s *scanner) errorf(line, col int, format string, args ...any) error {
+	return &Error{
+		File: s.file,
+		Line: line,
+		Pos:  col,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func errEscape(seq string) error {
+	return fmt.Errorf("invalid escape sequence '%s'", seq)
+}
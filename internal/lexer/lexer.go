@@ -3,9 +3,11 @@ package lexer
 import (
 	"crypto/md5"
 	"encoding/hex"
-	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 )
 
 type Lexer struct {
@@ -15,8 +17,6 @@ type Lexer struct {
 	otherFiles []string
 
 	hash string
-
-	pos int
 }
 
 func New(entry string, files ...string) *Lexer {
@@ -53,204 +53,321 @@ func (l *Lexer) parse(file string) ([]LexerToken, error) {
 	hash.Write(b)
 	l.hash = hex.EncodeToString(hash.Sum(nil))
 
-	content := string(b) + "\n"
-	contentLength := len(content)
-	inx, line, pos := 0, 0, 0
-	var tokens []LexerToken
+	return tokenize(file, string(b))
+}
+
+func (l *Lexer) Sum() string {
+	return l.hash
+}
 
-	for inx < contentLength {
-		char := content[inx]
+// Tokenize splits a piece of source code into tokens.
+// The file is only used as the position information of the tokens.
+func Tokenize(file, src string) ([]LexerToken, error) {
+	return tokenize(file, src)
+}
 
-		// Skip whitespace
-		if char == ' ' || char == '\t' || char == '\n' || char == '\r' {
-			inx++
-			pos++
+// scanner reads the source in a single pass. It keeps the line and the
+// column of the next character, both of them start at 1. Columns are
+// counted in characters, so multi-byte characters take one column.
+type scanner struct {
+	file string
+	src  string
 
-			if char == '\n' {
-				line++
-				pos = 0
-			}
+	inx  int
+	line int
+	col  int
 
-			continue
+	tokens []LexerToken
+}
+
+func tokenize(file, src string) ([]LexerToken, error) {
+	s := &scanner{file: file, src: src, line: 1, col: 1}
+
+	for s.inx < len(s.src) {
+		if err := s.scan(); err != nil {
+			return nil, err
 		}
+	}
 
-		// Handle common lexers
-		commonLexers(char, &inx, &pos, &line, contentLength, content)
-
-		inx++
-		pos++
-
-		if char == '<' && inx < contentLength && content[inx] == '>' {
-			startPos := inx - 1
-			inx++ // Skip '>'
-			pos++
-			templateDepth := 1
-
-			for inx < contentLength && templateDepth > 0 {
-				if content[inx] == '<' && inx+1 < contentLength && content[inx+1] == '>' {
-					templateDepth++
-					inx += 2
-					pos += 2
-				} else if content[inx] == '<' && inx+1 < contentLength && content[inx+1] == '/' && inx+2 < contentLength && content[inx+2] == '>' {
-					templateDepth--
-					inx += 3
-					pos += 3
-				} else {
-					inx++
-					pos++
-				}
-			}
+	return s.tokens, nil
+}
 
-			if templateDepth == 0 {
-				templateToken := content[startPos:inx]
-				tokens = append(tokens, newLexerToken(Template, templateToken, file, line, pos))
-				continue
-			}
+// scan reads the next token, or skips the next whitespace or comment
+func (s *scanner) scan() error {
+	char := s.peek(0)
+	line, col := s.line, s.col
+
+	switch {
+	case char == ' ' || char == '\t' || char == '\n' || char == '\r':
+		s.advance(1)
+		return nil
+	case char == '/' && s.peek(1) == '/':
+		for s.inx < len(s.src) && s.peek(0) != '\n' {
+			s.advance(1)
+		}
+		return nil
+	case char == '/' && s.peek(1) == '*':
+		end := strings.Index(s.src[s.inx+2:], "*/")
+		if end == -1 {
+			return s.errorf(line, col, "unterminated comment")
+		}
+		s.advance(end + 4)
+		return nil
+	case char == '<' && s.peek(1) == '>':
+		return s.scanTemplate()
+	case char == '"' || char == '\'':
+		return s.scanString(char)
+	case isDigit(char):
+		return s.scanNumber()
+	case isLetter(char):
+		start := s.inx
+		for s.inx < len(s.src) && (isLetter(s.peek(0)) || isDigit(s.peek(0))) {
+			s.advance(1)
+		}
+
+		word := s.src[start:s.inx]
+		s.emit(isToken(word), word, line, col)
+		return nil
+	}
 
-			return nil, fmt.Errorf("unbalanced template tags at line %d, pos %d", line, pos)
+	// Operators and punctuation, the longest one wins
+	for _, op := range operators {
+		if strings.HasPrefix(s.src[s.inx:], op) {
+			s.advance(len(op))
+			s.emit(isToken(op), op, line, col)
+			return nil
 		}
+	}
 
-		// Check for function call patterns: IDENTIFIER + ( ... )
-		if isIdentifierChar(char) {
-			startPos := inx - 1
-			for inx < contentLength && isIdentifierChar(content[inx]) {
-				inx++
-				pos++
-			}
-			identifier := content[startPos:inx]
-
-			// Check if followed by '(' to determine if it's a function call
-			if inx < contentLength && content[inx] == '(' {
-				funcStart := startPos
-				parensCount := 1
-				inx++ // Skip '('
-				pos++
-
-				for inx < contentLength && parensCount > 0 {
-					if content[inx] == '(' {
-						parensCount++
-					} else if content[inx] == ')' {
-						parensCount--
-					}
-					inx++
-					pos++
-				}
-
-				if parensCount == 0 {
-					// Function call token
-					funcCall := content[funcStart:inx]
-					tokens = append(tokens, newLexerToken(FuncCall, funcCall, file, line, pos))
-					continue
-				}
-
-				// Syntax error: unbalanced parentheses
-				return nil, fmt.Errorf("unbalanced parentheses in function call at line %d, pos %d", line, pos)
-			}
+	r, _ := utf8.DecodeRuneInString(s.src[s.inx:])
+	return s.errorf(line, col, "unexpected character %q", r)
+}
 
-			t := isToken(identifier)
-			// Regular identifier token
-			tokens = append(tokens, newLexerToken(t, identifier, file, line, pos))
-			continue
+// operators are sorted by length, so `<=` is matched before `<`
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||", "++", "--",
+	"=", "!", "<", ">", "+", "-", "*", "/", "%",
+	"(", ")", "[", "]", "{", "}", ",", ":", ";", ".", "#", "@",
+}
+
+// scanTemplate reads a template literal with its nested templates.
+// The value of the token is the literal with its <> and </> tags.
+func (s *scanner) scanTemplate() error {
+	start, line, col := s.inx, s.line, s.col
+	s.advance(len(TemplateStart.String()))
+	depth := 1
+
+	for depth > 0 {
+		if s.inx >= len(s.src) {
+			return s.errorf(line, col, "unterminated template, missing %s", TemplateEnd)
 		}
 
-		// Handle string literals (including escape characters)
-		if char == '"' {
-			startPos := inx - 1
-			for inx < contentLength && content[inx] != '"' {
-				// Handle escape characters
-				if content[inx] == '\\' {
-					inx++ // skip the escape character
-				}
-				inx++
-				pos++
-			}
-			inx++ // Skip closing quote
-			tokens = append(tokens, newLexerToken(DoubleStringLiteral, content[startPos:inx], file, line, pos))
-			continue
+		switch {
+		case strings.HasPrefix(s.src[s.inx:], TemplateStart.String()):
+			depth++
+			s.advance(len(TemplateStart.String()))
+		case strings.HasPrefix(s.src[s.inx:], TemplateEnd.String()):
+			depth--
+			s.advance(len(TemplateEnd.String()))
+		default:
+			s.advance(1)
 		}
+	}
 
-		if char == ';' {
-			tokens = append(tokens, newLexerToken(SemiColon, ";", file, line, pos))
-			continue
+	s.emit(Template, s.src[start:s.inx], line, col)
+	return nil
+}
+
+// scanString reads a string literal. The value of the token is the
+// content of the string with the escape sequences replaced.
+func (s *scanner) scanString(quote byte) error {
+	line, col := s.line, s.col
+	s.advance(1)
+
+	var sb strings.Builder
+	for {
+		if s.inx >= len(s.src) {
+			return s.errorf(line, col, "unterminated string")
 		}
 
-		if char == '=' {
-			if inx < contentLength && content[inx] == '=' {
-				tokens = append(tokens, newLexerToken(Equal, "==", file, line, pos))
-				inx++
-				pos++
-				continue
-			}
-			tokens = append(tokens, newLexerToken(Assign, "=", file, line, pos))
-			continue
+		char := s.peek(0)
+		if char == quote {
+			s.advance(1)
+			break
 		}
 
-		if char == '!' && inx < contentLength && content[inx] == '=' {
-			tokens = append(tokens, newLexerToken(NotEqual, "!=", file, line, pos))
-			inx++
-			pos++
+		if char != '\\' {
+			sb.WriteByte(char)
+			s.advance(1)
 			continue
 		}
 
-		if char == '&' && inx < contentLength && content[inx] == '&' {
-			tokens = append(tokens, newLexerToken(And, "&&", file, line, pos))
-			inx++
-			pos++
-			continue
+		escLine, escCol := s.line, s.col
+		r, err := s.scanEscape()
+		if err != nil {
+			return s.errorf(escLine, escCol, "%v", err)
 		}
+		sb.WriteRune(r)
+	}
 
-		if char == '|' && inx < contentLength && content[inx] == '|' {
-			tokens = append(tokens, newLexerToken(Or, "||", file, line, pos))
-			inx++
-			pos++
-			continue
+	t := DoubleStringLiteral
+	if quote == '\'' {
+		t = SingleStringLiteral
+	}
+
+	s.emit(t, sb.String(), line, col)
+	return nil
+}
+
+// scanEscape reads an escape sequence after a backslash
+func (s *scanner) scanEscape() (rune, error) {
+	s.advance(1) // Skip '\'
+	if s.inx >= len(s.src) {
+		return 0, errEscape("\\")
+	}
+
+	char := s.peek(0)
+	s.advance(1)
+
+	switch char {
+	case 'n':
+		return '\n', nil
+	case 't':
+		return '\t', nil
+	case 'r':
+		return '\r', nil
+	case 'b':
+		return '\b', nil
+	case 'f':
+		return '\f', nil
+	case 'v':
+		return '\v', nil
+	case '0':
+		return 0, nil
+	case '\\', '"', '\'':
+		return rune(char), nil
+	case 'x', 'u', 'U':
+		size := map[byte]int{'x': 2, 'u': 4, 'U': 8}[char]
+		if s.inx+size > len(s.src) {
+			return 0, errEscape(s.src[s.inx-2 : min(s.inx+size, len(s.src))])
 		}
 
-		if char == '+' && inx < contentLength && content[inx] == '+' {
-			tokens = append(tokens, newLexerToken(Increment, "++", file, line, pos))
-			inx++
-			pos++
-			continue
+		digits := s.src[s.inx : s.inx+size]
+		v, err := strconv.ParseUint(digits, 16, 32)
+		if err != nil || !utf8.ValidRune(rune(v)) {
+			return 0, errEscape(s.src[s.inx-2 : s.inx+size])
 		}
 
-		if char == '-' && inx < contentLength && content[inx] == '-' {
-			tokens = append(tokens, newLexerToken(Decrement, "--", file, line, pos))
-			inx++
-			pos++
-			continue
+		s.advance(size)
+		return rune(v), nil
+	}
+
+	return 0, errEscape(s.src[s.inx-2 : s.inx])
+}
+
+// scanNumber reads a decimal or a hexadecimal number. Decimal numbers
+// can have a fraction and an exponent: 12, 0x1F, 1.5, 2e10, 1.5e-3
+func (s *scanner) scanNumber() error {
+	start, line, col := s.inx, s.line, s.col
+
+	if s.peek(0) == '0' && (s.peek(1) == 'x' || s.peek(1) == 'X') {
+		s.advance(2)
+		if !isHexDigit(s.peek(0)) {
+			return s.errorf(line, col, "invalid number '%s'", s.src[start:s.inx])
+		}
+		for isHexDigit(s.peek(0)) {
+			s.advance(1)
 		}
+	} else {
+		s.digits()
 
-		if char == '{' {
-			tokens = append(tokens, newLexerToken(CurlyBraceStart, "{", file, line, pos))
-			continue
+		if s.peek(0) == '.' && isDigit(s.peek(1)) {
+			s.advance(1)
+			s.digits()
 		}
 
-		if char == '}' {
-			tokens = append(tokens, newLexerToken(CurlyBraceEnd, "}", file, line, pos))
-			continue
+		if s.peek(0) == 'e' || s.peek(0) == 'E' {
+			exp := 1
+			if s.peek(1) == '+' || s.peek(1) == '-' {
+				exp++
+			}
+
+			if !isDigit(s.peek(exp)) {
+				return s.errorf(line, col, "invalid number '%s', missing exponent", s.src[start:s.inx+exp])
+			}
+
+			s.advance(exp)
+			s.digits()
 		}
+	}
 
-		// Handle other tokens like operators or unknowns
-		tokens = append(tokens, newLexerToken(Unknown, string(char), file, line, pos))
+	if isLetter(s.peek(0)) || isDigit(s.peek(0)) {
+		end := s.inx
+		for end < len(s.src) && (isLetter(s.src[end]) || isDigit(s.src[end])) {
+			end++
+		}
+		return s.errorf(line, col, "invalid number '%s'", s.src[start:end])
 	}
 
-	return tokens, nil
+	s.emit(Number, s.src[start:s.inx], line, col)
+	return nil
 }
 
-func (l *Lexer) Sum() string {
-	return l.hash
+func (s *scanner) digits() {
+	for isDigit(s.peek(0)) {
+		s.advance(1)
+	}
 }
 
-func isIdentifierChar(c byte) bool {
-	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c == '_') || (c >= '0' && c <= '9') || c == '.' || c == '#'
+// peek returns the character at the offset from the next one, or 0 after the end
+func (s *scanner) peek(offset int) byte {
+	if s.inx+offset >= len(s.src) {
+		return 0
+	}
+	return s.src[s.inx+offset]
 }
 
-func pref(content string, length, inx int, token Token) bool {
-	var l = inx - len(token.String())
-
-	if l < 0 || inx >= length {
-		return false
+// advance moves forward by n bytes and updates the position
+func (s *scanner) advance(n int) {
+	for i := 0; i < n && s.inx < len(s.src); i++ {
+		char := s.src[s.inx]
+		s.inx++
+
+		switch {
+		case char == '\n':
+			s.line++
+			s.col = 1
+		case !utf8.RuneStart(char):
+			// Continuation bytes belong to the column of their first byte
+		default:
+			s.col++
+		}
 	}
+}
+
+// emit adds a token that starts at line and col and ends at the next character
+func (s *scanner) emit(t Token, value string, line, col int) {
+	s.tokens = append(s.tokens, LexerToken{
+		Type:  t,
+		Value: value,
+		Info: TokenInfo{
+			File:    s.file,
+			Line:    line,
+			Pos:     col,
+			EndLine: s.line,
+			EndPos:  s.col,
+		},
+	})
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
 
-	return content[l:inx] == token.String()
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '_'
 }
@@ -0,0 +1,118 @@
+package lexer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	src := "let x = user.name(\"a\\tb\", 'c\\'d', 0x1F, 1.5e-3);\n/* skipped */ func string#up() { x++; } // comment\nif a <= 2 && !b { @err }"
+
+	want := []struct {
+		typ   Token
+		value string
+		line  int
+		pos   int
+	}{
+		{Let, "let", 1, 1},
+		{Identifier, "x", 1, 5},
+		{Assign, "=", 1, 7},
+		{Identifier, "user", 1, 9},
+		{Dot, ".", 1, 13},
+		{Identifier, "name", 1, 14},
+		{ParantesisStart, "(", 1, 18},
+		{DoubleStringLiteral, "a\tb", 1, 19},
+		{Comma, ",", 1, 25},
+		{SingleStringLiteral, "c'd", 1, 27},
+		{Comma, ",", 1, 33},
+		{Number, "0x1F", 1, 35},
+		{Comma, ",", 1, 39},
+		{Number, "1.5e-3", 1, 41},
+		{ParantesisEnd, ")", 1, 47},
+		{SemiColon, ";", 1, 48},
+		{Func, "func", 2, 15},
+		{Identifier, "string", 2, 20},
+		{Hash, "#", 2, 26},
+		{Identifier, "up", 2, 27},
+		{ParantesisStart, "(", 2, 29},
+		{ParantesisEnd, ")", 2, 30},
+		{CurlyBraceStart, "{", 2, 32},
+		{Identifier, "x", 2, 34},
+		{Increment, "++", 2, 35},
+		{SemiColon, ";", 2, 37},
+		{CurlyBraceEnd, "}", 2, 39},
+		{If, "if", 3, 1},
+		{Identifier, "a", 3, 4},
+		{LessEqual, "<=", 3, 6},
+		{Number, "2", 3, 9},
+		{And, "&&", 3, 11},
+		{Not, "!", 3, 14},
+		{Identifier, "b", 3, 15},
+		{CurlyBraceStart, "{", 3, 17},
+		{At, "@", 3, 19},
+		{Identifier, "err", 3, 20},
+		{CurlyBraceEnd, "}", 3, 24},
+	}
+
+	tokens, err := Tokenize("test.smt", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != len(want) {
+		t.Fatalf("expected %d tokens, got %d: %+v", len(want), len(tokens), tokens)
+	}
+
+	for i, w := range want {
+		got := tokens[i]
+		if got.Type != w.typ || got.Value != w.value || got.Info.Line != w.line || got.Info.Pos != w.pos {
+			t.Errorf("token %d: want %s %q at %d:%d, got %s %q at %d:%d", i, w.typ, w.value, w.line, w.pos, got.Type, got.Value, got.Info.Line, got.Info.Pos)
+		}
+	}
+}
+
+func TestTokenizeTemplate(t *testing.T) {
+	tokens, err := Tokenize("test.smt", "let t = <>\n  <p>é {{ a }}</p>\n  <>nested</>\n</>; x")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(tokens) != 6 || tokens[3].Type != Template || tokens[3].Info.Pos != 9 {
+		t.Fatalf("unexpected template tokens: %+v", tokens)
+	}
+
+	// Multi-byte characters take a single column
+	if x := tokens[5]; x.Info.Line != 4 || x.Info.Pos != 6 {
+		t.Errorf("expected x at 4:6, got %d:%d", x.Info.Line, x.Info.Pos)
+	}
+}
+
+func TestTokenizeErrors(t *testing.T) {
+	tests := map[string]struct {
+		line, pos int
+	}{
+		"let s = \"abc":       {1, 9},
+		"let s = 'a\\qb';":    {1, 11},
+		"let s = \"\\u12\";":  {1, 10},
+		"\nlet n = 12abc;":    {2, 9},
+		"let n = 1e;":         {1, 9},
+		"let n = 0x;":         {1, 9},
+		"let t = <>\n<p>":     {1, 9},
+		"/* comment":          {1, 1},
+		"let a = 1;\n  a ~ 2": {2, 5},
+	}
+
+	for src, want := range tests {
+		_, err := Tokenize("test.smt", src)
+
+		var lexErr *Error
+		if !errors.As(err, &lexErr) {
+			t.Errorf("%q: expected a lexer error, got %v", src, err)
+			continue
+		}
+
+		if lexErr.Line != want.line || lexErr.Pos != want.pos {
+			t.Errorf("%q: expected error at %d:%d, got %d:%d (%s)", src, want.line, want.pos, lexErr.Line, lexErr.Pos, lexErr.Msg)
+		}
+	}
+}
@@ -1,29 +1,21 @@
 package lexer
 
+// LexerToken is a token of the source code. Line and Pos are the line and
+// the column of its first character, both start at 1. EndLine and EndPos
+// are the position right after its last character.
 type LexerToken struct {
-	Type  Token  `json:"token"`
-	Value string `json:"value"`
-	Info  struct {
-		File string `json:"file"`
-		Line int    `json:"line"`
-		Pos  int    `json:"pos"`
-	}
+	Type  Token     `json:"token"`
+	Value string    `json:"value"`
+	Info  TokenInfo `json:"info"`
 }
 
-func newLexerToken(t Token, v string, file string, line, pos int) LexerToken {
-	return LexerToken{
-		Type:  t,
-		Value: v,
-		Info: struct {
-			File string `json:"file"`
-			Line int    `json:"line"`
-			Pos  int    `json:"pos"`
-		}{
-			File: file,
-			Line: line + 1,
-			Pos:  pos,
-		},
-	}
+// TokenInfo is the position of a token
+type TokenInfo struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Pos     int    `json:"pos"`
+	EndLine int    `json:"end_line"`
+	EndPos  int    `json:"end_pos"`
 }
 
 type Token int
@@ -72,12 +64,22 @@ const (
 	UseToken
 	// Func creates a new function
 	Func
-	// FuncCall calls a function
+	// FuncCall marks the function call statements of the parser
 	FuncCall
+	// Component creates a template component
+	Component
 	// ParantesisStart is the start of a parantesis: (
 	ParantesisStart
 	// ParantesisEnd is the end of a parantesis: )
 	ParantesisEnd
+	// Comma separates arguments: ,
+	Comma
+	// BracketStart is the start of a list or an index: [
+	BracketStart
+	// BracketEnd is the end of a list or an index: ]
+	BracketEnd
+	// Colon separates the keys and values of a map: :
+	Colon
 	// CurlyBraceStart is the start of a curly brace: {
 	CurlyBraceStart
 	// CurlyBraceEnd is the end of a curly brace: }
@@ -86,9 +88,25 @@ const (
 	Return
 	// Identifier is an identifier
 	Identifier
+	// Number is a decimal or a hexadecimal number: 12, 1.5e3, 0xFF
+	Number
+	// Bool is a boolean: true or false
+	Bool
+	// Dot accesses a field or a method: .
+	Dot
+	// Hash separates the type and the name of a method: #
+	Hash
+	// At starts a macro: @
+	At
 
 	For = iota + 100
 	While
+	// Break exits the closest loop
+	Break
+	// Continue skips to the next iteration of the closest loop
+	Continue
+	// In separates the variables and the collection of a for-in loop
+	In
 	If
 	Else
 	Equal
@@ -103,12 +121,20 @@ const (
 	Division
 	Modulo
 
+	LessThan
+	LessEqual
+	GreaterThan
+	GreaterEqual
+	Not
+
 	// Unknown is an unknown token
 	Unknown = iota + 10000
 )
 
 func (t Token) String() string {
 	switch t {
+	case Namespace:
+		return "namespace"
 	case Use:
 		return "use"
 	case Let:
@@ -117,6 +143,10 @@ func (t Token) String() string {
 		return "const"
 	case Assign:
 		return "="
+	case Increment:
+		return "++"
+	case Decrement:
+		return "--"
 	case Nil:
 		return "nil"
 	case DoubleStringLiteral:
@@ -143,16 +173,80 @@ func (t Token) String() string {
 		return "func"
 	case FuncCall:
 		return "funcCall"
+	case Component:
+		return "component"
 	case ParantesisStart:
 		return "("
 	case ParantesisEnd:
 		return ")"
+	case Comma:
+		return ","
+	case BracketStart:
+		return "["
+	case BracketEnd:
+		return "]"
+	case Colon:
+		return ":"
 	case CurlyBraceStart:
 		return "{"
 	case CurlyBraceEnd:
 		return "}"
 	case Return:
 		return "return"
+	case Identifier:
+		return "identifier"
+	case Number:
+		return "number"
+	case Bool:
+		return "bool"
+	case Dot:
+		return "."
+	case Hash:
+		return "#"
+	case At:
+		return "@"
+	case For:
+		return "for"
+	case While:
+		return "while"
+	case Break:
+		return "break"
+	case Continue:
+		return "continue"
+	case In:
+		return "in"
+	case If:
+		return "if"
+	case Else:
+		return "else"
+	case Equal:
+		return "=="
+	case NotEqual:
+		return "!="
+	case And:
+		return "&&"
+	case Or:
+		return "||"
+	case Addition:
+		return "+"
+	case Subtraction:
+		return "-"
+	case Multiplication:
+		return "*"
+	case Division:
+		return "/"
+	case Modulo:
+		return "%"
+	case LessThan:
+		return "<"
+	case LessEqual:
+		return "<="
+	case GreaterThan:
+		return ">"
+	case GreaterEqual:
+		return ">="
+	case Not:
+		return "!"
 	default:
 		return "unknown"
 	}
@@ -164,18 +258,28 @@ func isToken(s string) Token {
 		return Namespace
 	case "use":
 		return Use
+	case "export":
+		return Export
 	case "let":
 		return Let
 	case "const":
 		return Const
 	case "func":
 		return Func
+	case "component":
+		return Component
 	case "return":
 		return Return
 	case "for":
 		return For
 	case "while":
 		return While
+	case "break":
+		return Break
+	case "continue":
+		return Continue
+	case "in":
+		return In
 	case "if":
 		return If
 	case "else":
@@ -196,12 +300,46 @@ func isToken(s string) Token {
 		return Division
 	case "%":
 		return Modulo
+	case "<":
+		return LessThan
+	case "<=":
+		return LessEqual
+	case ">":
+		return GreaterThan
+	case ">=":
+		return GreaterEqual
+	case "!":
+		return Not
+	case "&&":
+		return And
+	case "||":
+		return Or
+	case "(":
+		return ParantesisStart
+	case ")":
+		return ParantesisEnd
+	case ",":
+		return Comma
+	case "[":
+		return BracketStart
+	case "]":
+		return BracketEnd
+	case ":":
+		return Colon
 	case "++":
 		return Increment
 	case "--":
 		return Decrement
 	case "nil":
 		return Nil
+	case "true", "false":
+		return Bool
+	case ".":
+		return Dot
+	case "#":
+		return Hash
+	case "@":
+		return At
 	case ";":
 		return SemiColon
 	case "\"":
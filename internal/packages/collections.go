@@ -0,0 +1,168 @@
+package packages
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// List is an ordered collection of variables.
+// Lists are shared by reference between variables and packages.
+type List struct {
+	Items []*Variable
+}
+
+func NewList(items ...*Variable) *List {
+	return &List{
+		Items: items,
+	}
+}
+
+func (l *List) Len() int {
+	return len(l.Items)
+}
+
+// Get returns the item at the given index
+func (l *List) Get(i int) (*Variable, error) {
+	if i < 0 || i >= len(l.Items) {
+		return nil, fmt.Errorf("index %d out of range [0:%d]", i, len(l.Items))
+	}
+	return l.Items[i], nil
+}
+
+// Set replaces the item at the given index
+func (l *List) Set(i int, v *Variable) error {
+	if i < 0 || i >= len(l.Items) {
+		return fmt.Errorf("index %d out of range [0:%d]", i, len(l.Items))
+	}
+	l.Items[i] = v
+	return nil
+}
+
+func (l *List) Append(v ...*Variable) {
+	l.Items = append(l.Items, v...)
+}
+
+func (l *List) String() string {
+	items := make([]string, len(l.Items))
+	for i, item := range l.Items {
+		items[i] = formatItem(item)
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// Map is a collection of string keys and variables.
+// It keeps the insertion order of the keys.
+type Map struct {
+	keys   []string
+	values map[string]*Variable
+}
+
+func NewMap() *Map {
+	return &Map{
+		values: make(map[string]*Variable),
+	}
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+// Keys returns the keys in insertion order
+func (m *Map) Keys() []string {
+	return append([]string(nil), m.keys...)
+}
+
+func (m *Map) Get(key string) (*Variable, bool) {
+	v, ok := m.values[key]
+	return v, ok
+}
+
+// Set sets the value of the key, new keys are added to the end
+func (m *Map) Set(key string, v *Variable) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+func (m *Map) Delete(key string) {
+	if _, ok := m.values[key]; !ok {
+		return
+	}
+
+	delete(m.values, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+}
+
+func (m *Map) String() string {
+	items := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		items[i] = strconv.Quote(key) + ": " + formatItem(m.values[key])
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// MarshalJSON encodes the list as a JSON array
+func (l *List) MarshalJSON() ([]byte, error) {
+	values := make([]interface{}, len(l.Items))
+	for i, item := range l.Items {
+		if item != nil {
+			values[i] = item.Value
+		}
+	}
+	return json.Marshal(values)
+}
+
+// MarshalJSON encodes the map as a JSON object, keeping the order of the keys
+func (m *Map) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, key := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		var value interface{}
+		if v := m.values[key]; v != nil {
+			value = v.Value
+		}
+
+		v, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func formatItem(v *Variable) string {
+	if v == nil || v.Value == nil {
+		return "nil"
+	}
+
+	if v.Type.IsString() {
+		return strconv.Quote(v.Value.(string))
+	}
+
+	return fmt.Sprint(v.Value)
+}
@@ -25,15 +25,20 @@ func (HttpSec) fnEscapeHTML(args []*Variable) ([]*FuncReturn, error) {
 		return nil, errors.New("escapeHTML requires one argument")
 	}
 
-	if args[0].Type != VarString && args[0].Type != VarSingleString {
+	if !args[0].Type.IsString() {
 		return nil, errors.New("escapeHTML requires string arguments")
 	}
 
+	// Safe values are not escaped again by templates
+	if args[0].Type == VarSafe {
+		return []*FuncReturn{{Value: args[0].Value, Type: VarSafe}}, nil
+	}
+
 	escaped := html.EscapeString(args[0].Value.(string))
 	return []*FuncReturn{
 		{
 			Value: escaped,
-			Type:  VarString,
+			Type:  VarSafe,
 		},
 	}, nil
 }
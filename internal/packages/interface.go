@@ -1,5 +1,7 @@
 package packages
 
+import "io"
+
 type Variable struct {
 	Type  VarType
 	Value interface{}
@@ -10,7 +12,20 @@ type FuncReturn struct {
 	Value interface{}
 }
 
+// Func is a function value of Smarti. Packages get it as an argument of
+// VarFunc type and can call it, like the comparator of a sort.
+type Func interface {
+	Call(args ...*Variable) ([]*FuncReturn, error)
+}
+
 type Package interface {
 	Run(fn string, args []*Variable) ([]*FuncReturn, error)
 	Access(variable string) (*Variable, error)
 }
+
+// StreamWriter is implemented by the packages that write their argument
+// to an output, like response.write. A template literal passed to a function
+// with a writer is rendered directly into it instead of a string.
+type StreamWriter interface {
+	Stream(fn string) (io.Writer, bool)
+}
@@ -25,6 +25,14 @@ func (i IO) Run(fn string, args []*Variable) ([]*FuncReturn, error) {
 	return nil, fmt.Errorf("function io.%s does not exists", fn)
 }
 
+// Stream returns the standard output for io.write
+func (IO) Stream(fn string) (io.Writer, bool) {
+	if fn != "write" {
+		return nil, false
+	}
+	return os.Stdout, true
+}
+
 func (IO) Access(variable string) (*Variable, error) {
 	return nil, errors.New("io package does not have any variables")
 }
@@ -34,7 +42,7 @@ func (IO) fnRead(args []*Variable) ([]*FuncReturn, error) {
 	if len(args) == 0 {
 		fmt.Scan(&text)
 	} else {
-		if args[0].Type == VarString || args[0].Type == VarSingleString {
+		if args[0].Type.IsString() {
 			fmt.Print(args[0].Value)
 			fmt.Scan(&text)
 		} else {
@@ -67,7 +75,7 @@ func (b IO) fnWritef(args []*Variable) ([]*FuncReturn, error) {
 	values := make([]interface{}, len(args)-1)
 	for i, arg := range args {
 		if i == 0 {
-			if arg.Type == VarString || arg.Type == VarSingleString {
+			if arg.Type.IsString() {
 				format = arg.Value.(string)
 			} else {
 				return nil, fmt.Errorf("writef expects first argument to be a string")
@@ -48,7 +48,7 @@ func (r *Request) fnQuery(args []*Variable) ([]*FuncReturn, error) {
 		return nil, errors.New("query requires exatly one argument")
 	}
 
-	if args[0].Type != VarString && args[0].Type != VarSingleString {
+	if !args[0].Type.IsString() {
 		return nil, errors.New("query requires string arguments")
 	}
 
@@ -3,6 +3,7 @@ package packages
 import (
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 )
 
@@ -28,6 +29,15 @@ func (r *Response) Run(fn string, args []*Variable) ([]*FuncReturn, error) {
 	return nil, fmt.Errorf("function response.%s does not exists", fn)
 }
 
+// Stream returns the writer of response.write. Every write is flushed
+// to the client, so large templates are sent progressively.
+func (r *Response) Stream(fn string) (io.Writer, bool) {
+	if fn != "write" {
+		return nil, false
+	}
+	return flushWriter{r.rw}, true
+}
+
 func (*Response) Access(variable string) (*Variable, error) {
 	return nil, errors.New("response package does not have any variables")
 }
@@ -37,7 +47,7 @@ func (r *Response) fnWrite(args []*Variable) ([]*FuncReturn, error) {
 		return nil, errors.New("write method only accepts one argument")
 	}
 
-	if args[0].Type == VarString || args[0].Type == VarSingleString {
+	if args[0].Type.IsString() {
 		r.rw.Write([]byte(args[0].Value.(string)))
 		return nil, nil
 	}
@@ -50,8 +60,7 @@ func (r *Response) fnHeader(args []*Variable) ([]*FuncReturn, error) {
 		return nil, errors.New("header method accepts 2 arguments, key and value")
 	}
 
-	if args[0].Type == VarString || args[0].Type == VarSingleString &&
-		args[1].Type == VarString || args[1].Type == VarSingleString {
+	if args[0].Type.IsString() && args[1].Type.IsString() {
 		r.rw.Header().Add(args[0].Value.(string), args[1].Value.(string))
 		return nil, nil
 	}
@@ -71,3 +80,15 @@ func (r *Response) fnStatus(args []*Variable) ([]*FuncReturn, error) {
 
 	return nil, errors.New("status method only accepts number arguments")
 }
+
+type flushWriter struct {
+	rw http.ResponseWriter
+}
+
+func (w flushWriter) Write(b []byte) (int, error) {
+	n, err := w.rw.Write(b)
+	if f, ok := w.rw.(http.Flusher); ok && err == nil {
+		f.Flush()
+	}
+	return n, err
+}
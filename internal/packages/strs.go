@@ -29,7 +29,7 @@ func (Strs) fnLength(args []*Variable) ([]*FuncReturn, error) {
 		return nil, fmt.Errorf("length expects at least one argument")
 	}
 	arg := args[0]
-	if arg.Type != VarString && arg.Type != VarSingleString {
+	if !arg.Type.IsString() {
 		return nil, fmt.Errorf("length expects a string argument")
 	}
 
@@ -47,7 +47,7 @@ func (Strs) fnTrim(args []*Variable) ([]*FuncReturn, error) {
 		return nil, fmt.Errorf("trim expects at least one argument")
 	}
 	arg := args[0]
-	if arg.Type != VarString && arg.Type != VarSingleString {
+	if !arg.Type.IsString() {
 		return nil, fmt.Errorf("trim expects a string argument")
 	}
 
@@ -67,7 +67,7 @@ func (Strs) fnConcat(args []*Variable) ([]*FuncReturn, error) {
 	var sb strings.Builder
 
 	for _, arg := range args {
-		if arg.Type != VarString && arg.Type != VarSingleString {
+		if !arg.Type.IsString() {
 			return nil, fmt.Errorf("concat expects only string argument")
 		}
 
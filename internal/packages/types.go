@@ -10,7 +10,11 @@ const (
 	VarFloat        VarType = "float"
 	VarBool         VarType = "bool"
 	VarTemplate     VarType = "template"
+	VarSafe         VarType = "safe"
+	VarList         VarType = "list"
+	VarMap          VarType = "map"
 	VarVariable     VarType = "variable"
+	VarFunc         VarType = "func"
 
 	VarUnknown VarType = "#unknown#"
 
@@ -21,3 +25,9 @@ const (
 
 	UsePackage VarType = "use_package"
 )
+
+// IsString reports whether the type holds a string value.
+// Safe values are strings that templates output without escaping.
+func (t VarType) IsString() bool {
+	return t == VarString || t == VarSingleString || t == VarSafe
+}
@@ -0,0 +1,248 @@
+package runtime
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+func (c *CodeExecuter) evalList(e *ast.ListExpr) (interface{}, ast.NodeType, error) {
+	list := packages.NewList()
+
+	for _, item := range e.Items {
+		v, t, err := c.evalExpr(item)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		list.Append(&packages.Variable{
+			Type:  toPkgType(t),
+			Value: v,
+		})
+	}
+
+	return list, ast.VarList, nil
+}
+
+func (c *CodeExecuter) evalMap(e *ast.MapExpr) (interface{}, ast.NodeType, error) {
+	m := packages.NewMap()
+
+	for i, keyExpr := range e.Keys {
+		key, kt, err := c.evalExpr(keyExpr)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		if !isString(kt) {
+			return nil, ast.VarUnknown, exprErr(ErrInvalidIndex, keyExpr, fmt.Errorf("map keys must be strings, got %s", kt))
+		}
+
+		v, t, err := c.evalExpr(e.Values[i])
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		m.Set(key.(string), &packages.Variable{
+			Type:  toPkgType(t),
+			Value: v,
+		})
+	}
+
+	return m, ast.VarMap, nil
+}
+
+func (c *CodeExecuter) evalIndex(e *ast.IndexExpr) (interface{}, ast.NodeType, error) {
+	obj, ot, err := c.evalExpr(e.Object)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	index, it, err := c.evalExpr(e.Index)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	v, err := getIndex(obj, ot, index, it)
+	if err != nil {
+		return nil, ast.VarUnknown, exprErr(ErrInvalidIndex, e, err)
+	}
+
+	return v.Value, toNodeType(v.Type), nil
+}
+
+// getIndex returns a list item, a map value or a character of a string.
+// Missing map keys return nil.
+func getIndex(obj interface{}, ot ast.NodeType, index interface{}, it ast.NodeType) (*packages.Variable, error) {
+	switch {
+	case ot == ast.VarList:
+		if it != ast.VarNumber {
+			return nil, fmt.Errorf("list index must be a number, got %s", it)
+		}
+		return obj.(*packages.List).Get(index.(int))
+	case ot == ast.VarMap:
+		if !isString(it) {
+			return nil, fmt.Errorf("map key must be a string, got %s", it)
+		}
+
+		v, ok := obj.(*packages.Map).Get(index.(string))
+		if !ok {
+			return &packages.Variable{Type: packages.VarNil}, nil
+		}
+		return v, nil
+	case isString(ot):
+		if it != ast.VarNumber {
+			return nil, fmt.Errorf("string index must be a number, got %s", it)
+		}
+
+		chars := []rune(obj.(string))
+		i := index.(int)
+		if i < 0 || i >= len(chars) {
+			return nil, fmt.Errorf("index %d out of range [0:%d]", i, len(chars))
+		}
+		return &packages.Variable{Type: packages.VarString, Value: string(chars[i])}, nil
+	}
+
+	return nil, fmt.Errorf("%s value cannot be indexed", ot)
+}
+
+// getMember returns the field of an object, the length of lists,
+// maps and strings or the value of a map key.
+func getMember(obj interface{}, ot ast.NodeType, name string) (*packages.Variable, error) {
+	if o, ok := obj.(*object); ok {
+		return o.get(name)
+	}
+
+	if name == "length" {
+		switch {
+		case ot == ast.VarList:
+			return &packages.Variable{Type: packages.VarNumber, Value: obj.(*packages.List).Len()}, nil
+		case ot == ast.VarMap:
+			return &packages.Variable{Type: packages.VarNumber, Value: obj.(*packages.Map).Len()}, nil
+		case isString(ot):
+			return &packages.Variable{Type: packages.VarNumber, Value: utf8.RuneCountInString(obj.(string))}, nil
+		}
+	}
+
+	if ot == ast.VarMap {
+		return getIndex(obj, ot, name, ast.VarString)
+	}
+
+	return nil, fmt.Errorf("%s value does not have a field '%s'", ot, name)
+}
+
+// forInItems returns the values of the loop variables for each iteration.
+// A single variable gets the list items, the map keys or the characters,
+// a pair gets the index or key and the value.
+func forInItems(collection interface{}, typ ast.NodeType, pair bool) ([][]*packages.Variable, error) {
+	var keys, values []*packages.Variable
+
+	switch {
+	case typ == ast.VarList:
+		for i, item := range collection.(*packages.List).Items {
+			keys = append(keys, &packages.Variable{Type: packages.VarNumber, Value: i})
+			values = append(values, item)
+		}
+	case typ == ast.VarMap:
+		m := collection.(*packages.Map)
+		for _, key := range m.Keys() {
+			v, _ := m.Get(key)
+			keys = append(keys, &packages.Variable{Type: packages.VarString, Value: key})
+			values = append(values, v)
+		}
+	case isString(typ):
+		i := 0
+		for _, ch := range collection.(string) {
+			keys = append(keys, &packages.Variable{Type: packages.VarNumber, Value: i})
+			values = append(values, &packages.Variable{Type: packages.VarString, Value: string(ch)})
+			i++
+		}
+	default:
+		return nil, fmt.Errorf("cannot iterate over %s value", typ)
+	}
+
+	items := make([][]*packages.Variable, len(keys))
+	for i := range keys {
+		switch {
+		case pair:
+			items[i] = []*packages.Variable{keys[i], values[i]}
+		case typ == ast.VarMap:
+			items[i] = []*packages.Variable{keys[i]}
+		default:
+			items[i] = []*packages.Variable{values[i]}
+		}
+	}
+
+	return items, nil
+}
+
+// assignIndex executes an assignment to a list item, a map key or a field
+func (c *CodeExecuter) assignIndex(node *ast.AssignStmt) error {
+	value, vt, err := c.evalExpr(node.Value)
+	if err != nil {
+		return err
+	}
+
+	item := &packages.Variable{
+		Type:  toPkgType(vt),
+		Value: value,
+	}
+
+	switch target := node.Target.(type) {
+	case *ast.IndexExpr:
+		obj, ot, err := c.evalExpr(target.Object)
+		if err != nil {
+			return err
+		}
+
+		index, it, err := c.evalExpr(target.Index)
+		if err != nil {
+			return err
+		}
+
+		if err := setIndex(obj, ot, index, it, item); err != nil {
+			return exprErr(ErrInvalidIndex, target, err)
+		}
+		return nil
+	case *ast.MemberExpr:
+		obj, ot, err := c.evalExpr(target.Object)
+		if err != nil {
+			return err
+		}
+
+		if o, ok := obj.(*object); ok {
+			if err := o.set(target.Name, item); err != nil {
+				return exprErr(ErrInvalidIndex, target, err)
+			}
+			return nil
+		}
+
+		if ot != ast.VarMap {
+			return exprErr(ErrInvalidIndex, target, fmt.Errorf("cannot set field '%s' of %s value", target.Name, ot))
+		}
+
+		obj.(*packages.Map).Set(target.Name, item)
+		return nil
+	}
+
+	return nodeErr(ErrInvalidIndex, node, fmt.Errorf("invalid assignment target"))
+}
+
+func setIndex(obj interface{}, ot ast.NodeType, index interface{}, it ast.NodeType, item *packages.Variable) error {
+	switch ot {
+	case ast.VarList:
+		if it != ast.VarNumber {
+			return fmt.Errorf("list index must be a number, got %s", it)
+		}
+		return obj.(*packages.List).Set(index.(int), item)
+	case ast.VarMap:
+		if !isString(it) {
+			return fmt.Errorf("map key must be a string, got %s", it)
+		}
+		obj.(*packages.Map).Set(index.(string), item)
+		return nil
+	}
+
+	return fmt.Errorf("cannot assign to an index of %s value", ot)
+}
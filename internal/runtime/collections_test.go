@@ -0,0 +1,121 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+func TestListLiteral(t *testing.T) {
+	expectOutput(t, `
+let list = [1, "two", 3.5, [4], nil];
+out.write(list, ";", list.length, ";", list[1], ";", list[3][0]);
+`, `[1, "two", 3.5, [4], nil];5;two;4`)
+}
+
+func TestMapLiteral(t *testing.T) {
+	expectOutput(t, `
+let user = {"name": "John", "tags": ["a", "b"], "age": 30};
+out.write(user, ";", user.length, ";", user["name"], ";", user.tags[1], ";", user.missing);
+`, `{"name": "John", "tags": ["a", "b"], "age": 30};3;John;b;<nil>`)
+}
+
+func TestIndexAssignment(t *testing.T) {
+	expectOutput(t, `
+let list = [1, 2, 3];
+list[0] = 10;
+list[1]++;
+
+let m = {"a": [1]};
+m["b"] = 2;
+m.c = "three";
+m.a[0] = list[0] + 1;
+
+let alias = list;
+alias[2] = 30;
+
+out.write(list, ";", m);
+`, `[10, 3, 30];{"a": [11], "b": 2, "c": "three"}`)
+}
+
+func TestCollectionLoop(t *testing.T) {
+	expectOutput(t, `
+let api = {"data": [{"title": "A"}, {"title": "B"}]};
+for let i = 0; i < api.data.length; i++ {
+    let data = api.data[i];
+    out.write(<><h1>{{ data }}</h1></>);
+}
+`, `<h1>{&#34;title&#34;: &#34;A&#34;}</h1><h1>{&#34;title&#34;: &#34;B&#34;}</h1>`)
+}
+
+func TestStringIndex(t *testing.T) {
+	expectOutput(t, `
+let s = "héllo";
+out.write(s[1], s.length);
+`, "é5")
+}
+
+func TestIndexErrors(t *testing.T) {
+	tests := map[string]string{
+		`let l = [1]; let x = l[1];`:    "out of range",
+		`let l = [1]; let x = l["a"];`:  "must be a number",
+		`let m = {1: 2};`:               "must be strings",
+		`let n = 5; let x = n[0];`:      "cannot be indexed",
+		`let s = "abc"; s[0] = "x";`:    "cannot assign",
+		`let n = 5; let x = n.length;`:  "does not have a field",
+		`let l = [1, 2]; l.first = 1;`:  "cannot set field",
+		`let l = [1, 2]; let x = [1, 2`: "incomplete expression",
+		`let m = {"a" 1};`:              "expected ':'",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+// collectionPkg receives and returns collections
+type collectionPkg struct{}
+
+func (collectionPkg) Run(fn string, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	switch fn {
+	case "sum":
+		sum := 0
+		for _, item := range args[0].Value.(*packages.List).Items {
+			sum += item.Value.(int)
+		}
+		return []*packages.FuncReturn{{Type: packages.VarNumber, Value: sum}}, nil
+	case "pair":
+		m := packages.NewMap()
+		m.Set("key", args[0])
+		m.Set("value", args[1])
+		return []*packages.FuncReturn{{Type: packages.VarMap, Value: m}}, nil
+	}
+	return nil, errors.New("unknown function")
+}
+
+func (collectionPkg) Access(variable string) (*packages.Variable, error) {
+	return nil, errors.New("no variables")
+}
+
+func TestCollectionsInPackages(t *testing.T) {
+	runt := New()
+	runt.With("col", collectionPkg{})
+
+	out := runWith(t, runt, `
+func first(list) {
+    return list[0];
+}
+
+let p = col.pair("x", [1, 2, 3]);
+out.write(col.sum(p.value), ";", p.key, ";", first(p.value), ";", type(p));
+`)
+
+	if want := "6;x;1;map"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+}
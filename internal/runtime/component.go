@@ -0,0 +1,152 @@
+package runtime
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+)
+
+// componentChildren is the parameter of a component that gets
+// the content of its tag without the named slots
+const componentChildren = "children"
+
+// renderComponent calls a component with the values of its attributes
+// and slots. The attributes and slots are evaluated in the scope of the
+// template that uses the component.
+func (r *templateRenderer) renderComponent(ex Executer, node ast.TemplateNode) (interface{}, ast.NodeType, error) {
+	info := node.Info
+	errorf := func(format string, args ...interface{}) error {
+		return &NodeError{Type: ErrInvalidTemplate, Err: fmt.Errorf(format, args...), Info: info}
+	}
+
+	fn, ok := ex.lookupFunc(node.Content)
+	if !ok || !fn.Component {
+		return nil, ast.VarUnknown, errorf("component %s is not declared", node.Content)
+	}
+
+	params := make(map[string]int, len(fn.Params))
+	for i, arg := range fn.Params {
+		params[arg.Name] = i
+	}
+
+	args := make([]*variable, len(fn.Params))
+	set := func(name string, v *variable) error {
+		i, ok := params[name]
+		if !ok {
+			return errorf("component %s has no parameter '%s'", node.Content, name)
+		}
+
+		if args[i] != nil {
+			return errorf("parameter '%s' of component %s is already set", name, node.Content)
+		}
+
+		args[i] = v
+		return nil
+	}
+
+	for _, attr := range node.Attrs {
+		v, err := r.attrValue(ex, attr)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		if err := set(attr.Name, v); err != nil {
+			return nil, ast.VarUnknown, err
+		}
+	}
+
+	var children []ast.TemplateNode
+	for _, child := range node.Children {
+		if child.Kind != ast.TemplateSlot {
+			children = append(children, child)
+			continue
+		}
+
+		content, err := r.renderSlot(ex, child.Children)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		if err := set(child.Content, content); err != nil {
+			return nil, ast.VarUnknown, err
+		}
+	}
+
+	content, err := r.renderSlot(ex, children)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	// Whitespace around the named slots is not content
+	if strings.TrimSpace(content.Value.(string)) != "" {
+		if err := set(componentChildren, content); err != nil {
+			return nil, ast.VarUnknown, err
+		}
+	}
+
+	for i := range args {
+		if args[i] == nil {
+			args[i] = &variable{Type: ast.VarNil}
+		}
+	}
+
+	ret, err := ex.callDecl(fn, args, info)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	if len(ret) == 0 || !ret[0].Type.IsString() {
+		return nil, ast.VarUnknown, errorf("component %s must return a template", node.Content)
+	}
+
+	return ret[0].Value, toNodeType(ret[0].Type), nil
+}
+
+// attrValue evaluates an attribute of a component. A single expression
+// keeps its type, attributes with text are strings and attributes without
+// a value are true.
+func (r *templateRenderer) attrValue(ex Executer, attr ast.TemplateAttr) (*variable, error) {
+	if attr.Value == nil {
+		return &variable{Type: ast.VarBool, Value: true}, nil
+	}
+
+	var sb strings.Builder
+	for _, part := range attr.Value {
+		if part.Kind == ast.TemplateText {
+			sb.WriteString(part.Content)
+			continue
+		}
+
+		v, typ, _, err := r.eval(ex, part)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, filter := range part.Filters {
+			v, typ, err = r.filter(ex, filter, v, typ)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if len(attr.Value) == 1 {
+			return &variable{Type: typ, Value: v}, nil
+		}
+
+		sb.WriteString(formatValue(toPkgVar([]*variable{{Type: typ, Value: v}})[0]))
+	}
+
+	return &variable{Type: ast.VarString, Value: sb.String()}, nil
+}
+
+// renderSlot renders the content of a slot, it is written
+// by the component without escaping
+func (r *templateRenderer) renderSlot(ex Executer, nodes []ast.TemplateNode) (*variable, error) {
+	content, err := r.renderString(ex, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return &variable{Type: ast.VarSafe, Value: content}, nil
+}
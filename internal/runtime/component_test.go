@@ -0,0 +1,72 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestComponents(t *testing.T) {
+	out, err := execSource(t, `
+component Card(title, children, footer, active, count) {
+    <><div class="{{ if active == true }}active{{ end }}" data-count="{{ count }}"><h2>{{ title }}</h2>{{ children }}{{ if footer != nil }}<footer>{{ footer }}</footer>{{ end }}</div></>
+}
+
+component Badge(label) {
+    let text = label + "!";
+    return <><b>{{ text }}</b></>;
+}
+
+let users = ["<ann>", "bob"];
+out.write(<>{{ for i, user in users }}<Card title="#{{ i }} {{ user }}" count="{{ i + 1 }}" active>
+  <Badge label="{{ user | upper }}" />
+  <Slot name="footer">{{ user }}</Slot>
+</Card>{{ end }}<Card title="empty" /></>);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<div class="active" data-count="1"><h2>#0 &lt;ann&gt;</h2>
+  <b>&lt;ANN&gt;!</b>
+  
+<footer>&lt;ann&gt;</footer></div><div class="active" data-count="2"><h2>#1 bob</h2>
+  <b>BOB!</b>
+  
+<footer>bob</footer></div><div class="" data-count=""><h2>empty</h2></div>`
+	if out != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, out)
+	}
+}
+
+func TestComponentErrors(t *testing.T) {
+	tests := map[string]string{
+		`out.write(<><Card /></>);`:                                                                                      "component Card is not declared",
+		`func Card() { return "x"; } out.write(<><Card /></>);`:                                                          "component Card is not declared",
+		`component Card(title) { <>{{ title }}</> } out.write(<><Card name="x" /></>);`:                                  "component Card has no parameter 'name'",
+		`component Card(title) { <>{{ title }}</> } out.write(<><Card>x</Card></>);`:                                     "component Card has no parameter 'children'",
+		`component Card(title) { <>{{ title }}</> } out.write(<><Card title="a"><Slot name="title">b</Slot></Card></>);`: "parameter 'title' of component Card is already set",
+		`component Card() { return 1; } out.write(<><Card /></>);`:                                                       "component Card must return a template",
+		`component Card() { <></> } component Card() { <></> }`:                                                          "already declared",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestImportComponents(t *testing.T) {
+	out, err := execFiles(t, New(), map[string]string{
+		"main.smt":    `import("ui/card.smt"); out.write(<><Card title="x">y</Card></>);`,
+		"ui/card.smt": `component Card(title, children) { <><h1>{{ title }}</h1>{{ children }}</> }`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "<h1>x</h1>y" {
+		t.Errorf("want %q, got %q", "<h1>x</h1>y", out)
+	}
+}
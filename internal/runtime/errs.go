@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
 	"github.com/fatih/color"
 )
 
@@ -14,6 +15,7 @@ var (
 	ErrVariableNotDeclared     Err = fmt.Errorf("variable not declared")
 	ErrFuncNotDeclared         Err = fmt.Errorf("function not declared")
 	ErrVariableAlreadyDeclared Err = fmt.Errorf("variable already declared")
+	ErrConstantAssignment      Err = fmt.Errorf("cannot reassign constant")
 	ErrPackageNotImported      Err = fmt.Errorf("package not imported")
 	ErrPackageNotExists        Err = fmt.Errorf("package not exists")
 	ErrNotExpression           Err = fmt.Errorf("not an expression")
@@ -23,22 +25,126 @@ var (
 	ErrInvalidFuncArgument     Err = fmt.Errorf("invalid function argument")
 	ErrInvalidFuncReturn       Err = fmt.Errorf("invalid function return")
 	ErrInvalidTemplate         Err = fmt.Errorf("invalid template")
+	ErrInvalidLoop             Err = fmt.Errorf("invalid loop")
+	ErrInvalidIndex            Err = fmt.Errorf("invalid index")
+	ErrTemplateCycle           Err = fmt.Errorf("template cycle")
+	ErrInvalidType             Err = fmt.Errorf("invalid type")
+	ErrModule                  Err = fmt.Errorf("module error")
+	ErrImportCycle             Err = fmt.Errorf("import cycle")
 )
 
+// errBreak and errContinue unwind the executers until the closest loop.
+// The parser makes sure that they never appear outside of a loop.
+var (
+	errBreak    = errors.New("break outside of a loop")
+	errContinue = errors.New("continue outside of a loop")
+)
+
+// NodeError is an error that happened while executing a node
+type NodeError struct {
+	Type Err
+	Err  error
+	Info ast.NodeFileInfo
+	// Span is the source code of the node, it starts at Info
+	Span ast.Span
+	// Stack holds the Smarti function calls that led to the error, the innermost first
+	Stack []ast.Frame
+}
+
+func (e *NodeError) Error() string {
+	return e.Render(!color.NoColor)
+}
+
+// Report returns the report of the error with the source code of the node and the stack trace
+func (e *NodeError) Report() ast.Report {
+	span := e.Span
+	if span.Start.File == "" {
+		span = ast.Span{Start: e.Info, End: e.Info}
+	}
+
+	msg := e.Err.Error()
+	var posErr ast.ErrWithPos
+	if errors.As(e.Err, &posErr) {
+		msg = posErr.Err
+	}
+
+	return ast.Report{
+		Severity: ast.SeverityError,
+		Code:     e.Type.Error(),
+		Message:  msg,
+		Span:     &span,
+		Hint:     hints[e.Type],
+		Stack:    e.Stack,
+	}
+}
+
+// Render renders the error for the terminal, or as plain text if colored is false
+func (e *NodeError) Render(colored bool) string {
+	return e.Report().Render(colored)
+}
+
+func (e *NodeError) Unwrap() error {
+	return e.Err
+}
+
+// hints are short suggestions on how to fix the errors of a type
+var hints = map[Err]string{
+	ErrVariableNotDeclared:     "declare the variable with let before using it",
+	ErrVariableAlreadyDeclared: "use another name, or assign to the variable without let",
+	ErrPackageNotImported:      "import the package at the top of the file with use",
+	ErrPackageNotExists:        "check the name of the package",
+	ErrInvalidLoop:             "for-in loops iterate over lists, maps and strings",
+	ErrInvalidIndex:            "lists are indexed by numbers, maps by strings",
+	ErrTemplateCycle:           "a template cannot extend or include itself",
+	ErrInvalidType:             "a type can only be declared once, use another name",
+	ErrModule:                  "check the path of the module, it is relative to the current file",
+	ErrImportCycle:             "move the shared code of the modules into a third module",
+}
+
 func nodeErr(typ Err, n ast.Node, err error) error {
-	var runtimeErr Err
-	if errors.Is(err, runtimeErr) {
+	return spanErr(typ, n.Pos(), n.Range(), err)
+}
+
+func exprErr(typ Err, e ast.Expr, err error) error {
+	return nodeErr(typ, e, err)
+}
+
+// infoErr creates an error at a position that has no node, like a tag of a template
+func infoErr(typ Err, info ast.NodeFileInfo, err error) error {
+	return spanErr(typ, info, ast.Span{Start: info, End: info}, err)
+}
+
+func spanErr(typ Err, info ast.NodeFileInfo, span ast.Span, err error) error {
+	// Keep the innermost error, it has the most accurate position
+	var nodeError *NodeError
+	if errors.As(err, &nodeError) {
 		return err
 	}
 
-	redB := color.New(color.FgRed, color.Bold).SprintfFunc()
-	red := color.New(color.FgRed).SprintfFunc()
-	yel := color.New(color.FgYellow).SprintfFunc()
-
-	at := "unknown"
-	if n.Info.File != "" {
-		at = n.Info.String()
+	return &NodeError{
+		Type: typ,
+		Err:  err,
+		Info: info,
+		Span: span,
 	}
+}
 
-	return fmt.Errorf("%s %s\n%s\n%s\n", redB("Error type:"), red("%v,", typ), yel("%v at:", err), at)
+// errorValue returns the value of an error caught by the @err macro,
+// a map with the message and the code of the error
+func errorValue(err error) *packages.Map {
+	r := ast.Reports(err)[0]
+
+	m := packages.NewMap()
+	m.Set("message", &packages.Variable{Type: packages.VarString, Value: r.Message})
+	m.Set("code", &packages.Variable{Type: packages.VarString, Value: r.Code})
+	return m
+}
+
+// withFrame adds a function call to the stack trace of the error
+func withFrame(err error, name string, pos ast.NodeFileInfo) error {
+	var nodeError *NodeError
+	if errors.As(err, &nodeError) {
+		nodeError.Stack = append(nodeError.Stack, ast.Frame{Name: name, Pos: pos})
+	}
+	return err
 }
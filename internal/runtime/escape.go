@@ -0,0 +1,422 @@
+package runtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+)
+
+// unsafeValue replaces the values that cannot be escaped in their context,
+// like a javascript: URL or an attribute name
+const unsafeValue = "unsafe"
+
+type htmlState int
+
+const (
+	stateText htmlState = iota
+	stateTag
+	stateAttrName
+	stateAfterAttrName
+	stateBeforeAttrValue
+	stateAttrValue
+	stateComment
+	stateScript
+	stateStyle
+)
+
+// urlAttributes are the attributes that contain an URL
+var urlAttributes = map[string]bool{
+	"action":     true,
+	"background": true,
+	"cite":       true,
+	"codebase":   true,
+	"data":       true,
+	"formaction": true,
+	"href":       true,
+	"icon":       true,
+	"longdesc":   true,
+	"manifest":   true,
+	"poster":     true,
+	"src":        true,
+	"usemap":     true,
+	"xmlns":      true,
+}
+
+// htmlEscaper follows the HTML context of a template while the static parts
+// are written and escapes the interpolated values for the current context.
+type htmlEscaper struct {
+	state htmlState
+
+	tag   string
+	attr  string
+	quote byte
+	// value holds the attribute value written so far
+	value strings.Builder
+	// js follows the strings and the comments of a script
+	js jsState
+}
+
+// jsState follows the string literals and the comments of JavaScript code
+type jsState struct {
+	// quote is the quote of the open string literal
+	quote byte
+	// comment is '/' in a line comment and '*' in a block comment
+	comment byte
+}
+
+// step moves the state over the character at s[i]. It returns the number
+// of the following characters that belong to the same token.
+func (j *jsState) step(s string, i int) int {
+	c := s[i]
+
+	switch {
+	case j.comment == '/':
+		if c == '\n' {
+			j.comment = 0
+		}
+	case j.comment == '*':
+		if strings.HasPrefix(s[i:], "*/") {
+			j.comment = 0
+			return 1
+		}
+	case j.quote != 0:
+		switch c {
+		case '\\':
+			return 1
+		case j.quote:
+			j.quote = 0
+		}
+	case strings.HasPrefix(s[i:], "//"):
+		j.comment = '/'
+		return 1
+	case strings.HasPrefix(s[i:], "/*"):
+		j.comment = '*'
+		return 1
+	case c == '"' || c == '\'' || c == '`':
+		j.quote = c
+	}
+	return 0
+}
+
+// inLiteral reports whether the position is in a string or a comment
+func (j *jsState) inLiteral() bool {
+	return j.quote != 0 || j.comment != 0
+}
+
+// feed moves the context over a static part of the template
+func (e *htmlEscaper) feed(s string) {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch e.state {
+		case stateText:
+			switch {
+			case strings.HasPrefix(s[i:], "<!--"):
+				e.state = stateComment
+				i += 3
+			case c == '<' && i+1 < len(s) && (isLetter(s[i+1]) || s[i+1] == '/'):
+				name := s[i+1:]
+				if name[0] == '/' {
+					name = name[1:]
+				}
+
+				n := 0
+				for n < len(name) && (isLetter(name[n]) || name[n] >= '0' && name[n] <= '9' || name[n] == '-') {
+					n++
+				}
+
+				e.tag = strings.ToLower(name[:n])
+				if s[i+1] == '/' {
+					// Closing tags never open a script or a style
+					e.tag = "/" + e.tag
+				}
+
+				e.state = stateTag
+				i += len(s[i+1:]) - len(name) + n
+			}
+		case stateComment:
+			if strings.HasPrefix(s[i:], "-->") {
+				e.state = stateText
+				i += 2
+			}
+		case stateTag:
+			switch {
+			case c == '>':
+				e.closeTag()
+			case !isSpace(c) && c != '/':
+				e.attr = string(lower(c))
+				e.state = stateAttrName
+			}
+		case stateAttrName:
+			switch {
+			case c == '=':
+				e.state = stateBeforeAttrValue
+			case c == '>':
+				e.closeTag()
+			case isSpace(c):
+				e.state = stateAfterAttrName
+			default:
+				e.attr += string(lower(c))
+			}
+		case stateAfterAttrName:
+			switch {
+			case c == '=':
+				e.state = stateBeforeAttrValue
+			case c == '>':
+				e.closeTag()
+			case !isSpace(c) && c != '/':
+				e.attr = string(lower(c))
+				e.state = stateAttrName
+			}
+		case stateBeforeAttrValue:
+			switch {
+			case c == '"' || c == '\'':
+				e.openValue(c)
+			case c == '>':
+				e.closeTag()
+			case !isSpace(c):
+				e.openValue(0)
+				e.value.WriteByte(c)
+			}
+		case stateAttrValue:
+			switch {
+			case e.quote != 0 && c == e.quote:
+				e.state = stateTag
+			case e.quote == 0 && isSpace(c):
+				e.state = stateTag
+			case e.quote == 0 && c == '>':
+				e.closeTag()
+			default:
+				e.value.WriteByte(c)
+			}
+		case stateScript, stateStyle:
+			end := "</script"
+			if e.state == stateStyle {
+				end = "</style"
+			}
+
+			// Browsers end the script at </script even in a string or a comment
+			if len(s)-i >= len(end) && strings.EqualFold(s[i:i+len(end)], end) {
+				e.tag = "/" + end[2:]
+				e.state = stateTag
+				i += len(end) - 1
+				continue
+			}
+
+			if e.state == stateScript {
+				i += e.js.step(s, i)
+			}
+		}
+	}
+}
+
+func (e *htmlEscaper) openValue(quote byte) {
+	e.quote = quote
+	e.value.Reset()
+	e.state = stateAttrValue
+}
+
+func (e *htmlEscaper) closeTag() {
+	switch e.tag {
+	case "script":
+		e.state = stateScript
+		e.js = jsState{}
+	case "style":
+		e.state = stateStyle
+	default:
+		e.state = stateText
+	}
+}
+
+// escape formats the value for the current context. Safe values are HTML,
+// they are written as they are in text and in quoted attributes that are not
+// scripts, styles or URLs, and escaped like strings elsewhere. Nil values are
+// empty except in scripts where they are null.
+func (e *htmlEscaper) escape(v interface{}, typ ast.NodeType) string {
+	// An unquoted attribute value starts with the value: <div title={{ v }}>
+	if e.state == stateBeforeAttrValue {
+		e.openValue(0)
+	}
+
+	if typ == ast.VarSafe && e.safeContext() {
+		if e.state == stateAttrValue {
+			e.value.WriteString(v.(string))
+		}
+		return v.(string)
+	}
+
+	var s string
+	if v != nil {
+		s = fmt.Sprint(v)
+	}
+
+	switch e.state {
+	case stateTag, stateAttrName, stateAfterAttrName:
+		// Values can only be attribute names here, like <input {{ attr }}>
+		for _, r := range s {
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' {
+				return unsafeValue
+			}
+		}
+		return s
+	case stateAttrValue:
+		escaped := e.escapeAttr(v, s)
+		if strings.HasPrefix(e.attr, "on") {
+			// The quotes of the script are followed in the code the browser runs
+			e.value.WriteString(escaped)
+		} else {
+			e.value.WriteString(s)
+		}
+
+		if e.quote == 0 {
+			return escapeUnquoted(escaped)
+		}
+		return html.EscapeString(escaped)
+	case stateScript:
+		if e.js.inLiteral() {
+			return escapeJSString(s)
+		}
+		return escapeJSValue(v)
+	case stateStyle:
+		return escapeCSS(s)
+	}
+
+	return html.EscapeString(s)
+}
+
+// safeContext reports whether safe HTML can be written as it is
+func (e *htmlEscaper) safeContext() bool {
+	switch e.state {
+	case stateText:
+		return true
+	case stateAttrValue:
+		return e.quote != 0 && !strings.HasPrefix(e.attr, "on") && e.attr != "style" && !urlAttributes[e.attr]
+	}
+	return false
+}
+
+// escapeAttr escapes the value for the attribute's language,
+// the result still has to be HTML escaped.
+func (e *htmlEscaper) escapeAttr(v interface{}, s string) string {
+	switch {
+	case strings.HasPrefix(e.attr, "on"):
+		// The value is in the script of the attribute after the entities are decoded
+		var js jsState
+		code := html.UnescapeString(e.value.String())
+		for i := 0; i < len(code); i++ {
+			i += js.step(code, i)
+		}
+
+		if js.inLiteral() {
+			return escapeJSString(s)
+		}
+		return strings.ReplaceAll(escapeJSValue(v), "'", `\u0027`)
+	case e.attr == "style":
+		return escapeCSS(s)
+	case urlAttributes[e.attr]:
+		prefix := html.UnescapeString(e.value.String())
+
+		// Values after the path are query parameters or fragments
+		if strings.ContainsAny(prefix, "?#") {
+			return url.QueryEscape(s)
+		}
+
+		// The value can still be a part of the scheme: {{ scheme }}{{ rest }}
+		if !strings.ContainsAny(prefix, ":/") && !safeScheme(prefix+s) {
+			return "#" + unsafeValue
+		}
+
+		if prefix == "" {
+			return filterURL(s)
+		}
+		return url.PathEscape(s)
+	}
+
+	return s
+}
+
+// safeScheme reports whether the URL is relative or its scheme is http, https,
+// mailto or tel. Browsers ignore the tabs and the newlines in the scheme.
+func safeScheme(s string) bool {
+	s = strings.NewReplacer("\t", "", "\n", "", "\r", "").Replace(s)
+	if i := strings.IndexAny(s, ":/?#"); i != -1 && s[i] == ':' {
+		switch strings.ToLower(strings.TrimSpace(s[:i])) {
+		case "http", "https", "mailto", "tel":
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// filterURL allows relative URLs and the http, https, mailto and tel schemes
+func filterURL(s string) string {
+	if !safeScheme(s) {
+		return "#" + unsafeValue
+	}
+
+	var sb strings.Builder
+	for _, b := range []byte(s) {
+		if b > ' ' && b < 0x7f && b != '"' && b != '\'' && b != '<' && b != '>' && b != '\\' && b != '`' {
+			sb.WriteByte(b)
+			continue
+		}
+		fmt.Fprintf(&sb, "%%%02X", b)
+	}
+	return sb.String()
+}
+
+// escapeJSValue encodes the value as a JavaScript literal
+func escapeJSValue(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// escapeJSString escapes the value for the inside of a JavaScript string
+func escapeJSString(s string) string {
+	b, _ := json.Marshal(s)
+	s = string(b[1 : len(b)-1])
+	return strings.NewReplacer("'", `\u0027`, "`", `\u0060`, "$", `\u0024`).Replace(s)
+}
+
+// escapeCSS escapes the characters that can leave a CSS value
+func escapeCSS(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(" #.,%-_", r) {
+			sb.WriteRune(r)
+			continue
+		}
+		fmt.Fprintf(&sb, "\\%x ", r)
+	}
+	return sb.String()
+}
+
+// escapeUnquoted escapes the characters that end an unquoted attribute value
+func escapeUnquoted(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(" ", "&#32;", "\t", "&#9;", "\n", "&#10;", "\r", "&#13;", "=", "&#61;", "`", "&#96;").Replace(s)
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,83 @@
+package runtime
+
+import "testing"
+
+func TestTemplateEscaping(t *testing.T) {
+	tests := map[string]struct {
+		tmpl string
+		want string
+	}{
+		"text":            {`<p>{{ v }}</p>`, `<p>&lt;b&gt;&#34;x&#34; &amp; &#39;y&#39;&lt;/b&gt;</p>`},
+		"comment":         {`<!-- {{ v }} -->`, `<!-- &lt;b&gt;&#34;x&#34; &amp; &#39;y&#39;&lt;/b&gt; -->`},
+		"attribute":       {`<div title="{{ v }}">`, `<div title="&lt;b&gt;&#34;x&#34; &amp; &#39;y&#39;&lt;/b&gt;">`},
+		"unquoted":        {`<div title={{ name }}>`, `<div title=John&#32;Doe>`},
+		"attribute name":  {`<input {{ v }}>`, `<input unsafe>`},
+		"url":             {`<a href="{{ url }}">`, `<a href="#unsafe">`},
+		"split scheme":    {`<a href="{{ scheme }}{{ rest }}">`, `<a href="javascript#unsafe">`},
+		"static scheme":   {`<a href="java{{ scheme2 }}">`, `<a href="java#unsafe">`},
+		"https parts":     {`<a href="{{ https }}{{ rest }}">`, `<a href="https://x/:alert%281%29">`},
+		"relative url":    {`<a href="{{ path }}">`, `<a href="/users?name=John%20Doe&amp;x=1">`},
+		"url path":        {`<a href="/users/{{ name }}">`, `<a href="/users/John%20Doe">`},
+		"url query":       {`<a href='/search?q={{ v }}'>`, `<a href='/search?q=%3Cb%3E%22x%22+%26+%27y%27%3C%2Fb%3E'>`},
+		"script":          {`<script>let user = {{ user }};</script>`, `<script>let user = {"name":"\u003cb\u003e","tags":[1,2]};</script>`},
+		"script string":   {`<script>let s = "{{ v }}";</script>`, `<script>let s = "\u003cb\u003e\"x\" \u0026 \u0027y\u0027\u003c/b\u003e";</script>`},
+		"after script":    {`<script>x();</script><p>{{ name }}</p>`, `<script>x();</script><p>John Doe</p>`},
+		"script comment":  {"<script>// don't\n</script><a href=\"{{ url }}\">", "<script>// don't\n</script><a href=\"#unsafe\">"},
+		"block comment":   {`<script>/* "{{ v }}" */</script><a href="{{ url }}">`, `<script>/* "\u003cb\u003e\"x\" \u0026 \u0027y\u0027\u003c/b\u003e" */</script><a href="#unsafe">`},
+		"open string":     {`<script>let s = "a</script><a href="{{ url }}">`, `<script>let s = "a</script><a href="#unsafe">`},
+		"event handler":   {`<button onclick="greet({{ name }})">`, `<button onclick="greet(&#34;John Doe&#34;)">`},
+		"handler string":  {`<button onclick="select('{{ id }}')">`, `<button onclick="select('\u0027);alert(1);//')">`},
+		"handler quotes":  {`<button onclick='select("{{ id }}", {{ id }})'>`, `<button onclick='select("\u0027);alert(1);//", &#34;\u0027);alert(1);//&#34;)'>`},
+		"handler entity":  {`<button onclick="select(&#39;{{ v }}&#39;)">`, `<button onclick="select(&#39;\u003cb\u003e\&#34;x\&#34; \u0026 \u0027y\u0027\u003c/b\u003e&#39;)">`},
+		"style":           {`<style>p { color: {{ color }}; }</style>`, `<style>p { color: red\3b  background\3a  url\28 x\29 ; }</style>`},
+		"style attribute": {`<p style="color: {{ color }}">`, `<p style="color: red\3b  background\3a  url\28 x\29 ">`},
+		"safe":            {`<div>{{ raw(v) }}</div>`, `<div><b>"x" & 'y'</b></div>`},
+		"safe attribute":  {`<div title="{{ raw("a &amp; b") }}">`, `<div title="a &amp; b">`},
+		"safe script":     {`<script>let s = '{{ raw(id) }}';</script>`, `<script>let s = '\u0027);alert(1);//';</script>`},
+		"safe handler":    {`<button onclick="select('{{ raw(id) }}')">`, `<button onclick="select('\u0027);alert(1);//')">`},
+		"safe url":        {`<a href="{{ raw(url) }}">`, `<a href="#unsafe">`},
+		"safe unquoted":   {`<div title={{ raw(name) }}>`, `<div title=John&#32;Doe>`},
+		"safe joined":     {`<script>let s = {{ "a" + raw("<b>") }};</script>`, `<script>let s = "a\u003cb\u003e";</script>`},
+		"nested template": {`<ul>{{ item }}</ul>`, `<ul><li>&lt;b&gt;</li></ul>`},
+		"nil":             {`<p title="{{ nil }}">{{ nil }}</p><script>let x = {{ nil }};</script>`, `<p title=""></p><script>let x = null;</script>`},
+	}
+
+	for name, tt := range tests {
+		out, err := execSource(t, `
+let v = "<b>\"x\" & 'y'</b>";
+let name = "John Doe";
+let id = "');alert(1);//";
+let url = "javascript:alert(1)";
+let scheme = "javascript";
+let scheme2 = "script:alert(1)";
+let rest = ":alert(1)";
+let https = "https://x/";
+let path = "/users?name=John Doe&x=1";
+let color = "red; background: url(x)";
+let user = {"name": "<b>", "tags": [1, 2]};
+let item = <><li>{{ user.name }}</li></>;
+out.write(<>`+tt.tmpl+`</>);
+`)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if out != tt.want {
+			t.Errorf("%s:\nwant: %s\ngot:  %s", name, tt.want, out)
+		}
+	}
+}
+
+func TestSafeValues(t *testing.T) {
+	expectOutput(t, `
+use httpsec;
+
+let name = httpsec.escapeHTML("<b>");
+let list = "";
+for item in ["<i>", "<u>"] {
+    list = list + <><li>{{ item }}</li></>;
+}
+out.write(<><p>{{ name }}</p><ul>{{ list }}</ul></>, ";", type(name), ";", "<" + name);
+`, "<p>&lt;b&gt;</p><ul><li>&lt;i&gt;</li><li>&lt;u&gt;</li></ul>;safe;&lt;&lt;b&gt;")
+}
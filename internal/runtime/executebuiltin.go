@@ -15,6 +15,12 @@ func (c *CodeExecuter) ExecuteBuiltinMethod(e Executer, name string, args []*pac
 		return runFnType(args)
 	case "import":
 		return runFnImport(e, args)
+	case "raw":
+		return runFnRaw(args)
+	case "extends":
+		return runFnExtends(e, args)
+	case "include":
+		return runFnInclude(e, args)
 	}
 	return nil, fmt.Errorf("function %s does not exists or imported", name)
 }
@@ -32,12 +38,30 @@ func runFnType(args []*packages.Variable) ([]*packages.FuncReturn, error) {
 	}, nil
 }
 
+// runFnRaw marks a string as safe, templates output it without escaping
+func runFnRaw(args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("raw function expects 1 argument, %d given", len(args))
+	}
+
+	if !args[0].Type.IsString() {
+		return nil, fmt.Errorf("raw function expects string argument, %s given", args[0].Type)
+	}
+
+	return []*packages.FuncReturn{
+		{
+			Value: args[0].Value,
+			Type:  packages.VarSafe,
+		},
+	}, nil
+}
+
 func runFnImport(e Executer, args []*packages.Variable) ([]*packages.FuncReturn, error) {
 	if len(args) != 1 {
 		return nil, fmt.Errorf("import function expects 1 argument, %d given", len(args))
 	}
 
-	if args[0].Type != packages.VarString && args[0].Type != packages.VarSingleString {
+	if !args[0].Type.IsString() {
 		return nil, fmt.Errorf("import function expects string argument, %s given", args[0].Type)
 	}
 
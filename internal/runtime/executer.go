@@ -1,12 +1,12 @@
 package runtime
 
 import (
+	"errors"
 	"fmt"
 	"path/filepath"
 	"sync"
 
 	"github.com/bndrmrtn/smarti/internal/ast"
-	"github.com/bndrmrtn/smarti/internal/lexer"
 	"github.com/bndrmrtn/smarti/internal/packages"
 )
 
@@ -21,9 +21,15 @@ type CodeExecuter struct {
 	uses      map[string]packages.Package
 	variables map[string]*variable
 	funcs     map[string]funcDecl
+	types     map[string]*typeDecl
 
 	children []Executer
 
+	// tmpl is the layout state of the file, see templateState
+	tmpl *templateState
+	// imports are the files that import the module of the executer
+	imports []string
+
 	mu sync.Mutex
 }
 
@@ -37,6 +43,7 @@ func NewExecuter(runt *Runtime, parent Executer, file, namespace, scope string,
 		runt:      runt,
 		variables: make(map[string]*variable),
 		funcs:     make(map[string]funcDecl),
+		types:     make(map[string]*typeDecl),
 		children:  []Executer{},
 	}
 }
@@ -57,6 +64,37 @@ func (c *CodeExecuter) GetScope() string {
 	return c.scope
 }
 
+// templateState returns the layout state of the rendered file.
+// The executers of a file share the state of the file's root executer.
+func (c *CodeExecuter) templateState() *templateState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.tmpl != nil {
+		return c.tmpl
+	}
+
+	if c.parent != nil {
+		return c.parent.templateState()
+	}
+
+	file, _ := filepath.Abs(c.file)
+	c.tmpl = &templateState{stack: []string{file}}
+	return c.tmpl
+}
+
+func (c *CodeExecuter) setTemplateState(state *templateState) {
+	c.mu.Lock()
+	c.tmpl = state
+	c.mu.Unlock()
+}
+
+func (c *CodeExecuter) setImports(chain []string) {
+	c.mu.Lock()
+	c.imports = chain
+	c.mu.Unlock()
+}
+
 func (c *CodeExecuter) runtime() *Runtime {
 	return c.runt
 }
@@ -95,7 +133,7 @@ func (c *CodeExecuter) AssignVariable(name string, v *variable) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, ok := c.variables[name]
+	old, ok := c.variables[name]
 	if !ok {
 		if c.parent != nil {
 			return c.parent.AssignVariable(name, v)
@@ -104,6 +142,10 @@ func (c *CodeExecuter) AssignVariable(name string, v *variable) error {
 		return ErrVariableNotDeclared
 	}
 
+	if old.Const {
+		return ErrConstantAssignment
+	}
+
 	c.variables[name] = v
 	return nil
 }
@@ -116,8 +158,8 @@ func (c *CodeExecuter) DeclareFunc(name string, fn funcDecl) error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	_, ok := c.funcs[name]
-	if ok {
+	// A declaration that runs again, like in a function called twice, is not a redeclaration
+	if decl, ok := c.funcs[name]; ok && (decl.Info.File == "" || decl.Info != fn.Info) {
 		return fmt.Errorf("function %s() already declared", name)
 	}
 
@@ -126,6 +168,46 @@ func (c *CodeExecuter) DeclareFunc(name string, fn funcDecl) error {
 	return nil
 }
 
+func (c *CodeExecuter) lookupFunc(name string) (funcDecl, bool) {
+	c.mu.Lock()
+	fn, ok := c.funcs[name]
+	c.mu.Unlock()
+
+	if !ok && c.parent != nil {
+		return c.parent.lookupFunc(name)
+	}
+
+	return fn, ok
+}
+
+func (c *CodeExecuter) DeclareType(name string, t *typeDecl) error {
+	if c.parent != nil {
+		return c.parent.DeclareType(name, t)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.types[name]; ok {
+		return fmt.Errorf("type %s already declared", name)
+	}
+
+	c.types[name] = t
+	return nil
+}
+
+func (c *CodeExecuter) lookupType(name string) (*typeDecl, bool) {
+	c.mu.Lock()
+	t, ok := c.types[name]
+	c.mu.Unlock()
+
+	if !ok && c.parent != nil {
+		return c.parent.lookupType(name)
+	}
+
+	return t, ok
+}
+
 func (c *CodeExecuter) GetVariable(name string) (*variable, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
@@ -169,57 +251,298 @@ func (c *CodeExecuter) AccessVariableValue(name string) (*packages.Variable, err
 	}, err
 }
 
-func (c *CodeExecuter) Execute(nodes []ast.Node) ([]*packages.FuncReturn, error) {
+func (c *CodeExecuter) Execute(nodes []ast.Stmt) ([]*packages.FuncReturn, error) {
+	ret, err := c.execute(nodes)
+	if err != nil || ret != nil {
+		return ret, err
+	}
+
+	if c.namespace == "main" && c.parent == nil && c.scope == "global" {
+		if _, ok := c.funcs["main"]; !ok {
+			return nil, nil
+		}
+
+		_, err := c.callFunc(&ast.CallExpr{
+			Callee: &ast.IdentExpr{Name: "main"},
+		})
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// execute runs the nodes in the executer's scope. A non-nil return value
+// means that a return statement was reached and the caller should stop.
+func (c *CodeExecuter) execute(nodes []ast.Stmt) ([]*packages.FuncReturn, error) {
 	for _, node := range nodes {
-		switch node.Type {
-		case ast.VarExpression, ast.VarNil, ast.VarString, ast.VarSingleString, ast.VarNumber, ast.VarFloat, ast.VarBool, ast.VarTemplate, ast.VarVariable, ast.VarUnknown:
-			if _, _, err := c.createVariable(node); err != nil {
+		ret, err := c.executeStmt(node)
+		if err != nil || ret != nil {
+			return ret, err
+		}
+	}
+
+	return nil, nil
+}
+
+func (c *CodeExecuter) executeStmt(node ast.Stmt) ([]*packages.FuncReturn, error) {
+	switch node := node.(type) {
+	case *ast.VarDecl:
+		v := &variable{Type: ast.VarNil, Const: node.Const}
+		if node.Value != nil {
+			value, typ, err := c.evalExpr(node.Value)
+			if err != nil {
 				return nil, err
 			}
-		case ast.FuncCall:
-			if _, err := c.callFunc(node); err != nil {
+			v = &variable{Type: typ, Value: value, Const: node.Const}
+		}
+
+		c.mu.Lock()
+		c.variables[node.Name] = v
+		c.mu.Unlock()
+	case *ast.UseStmt:
+		return nil, c.useModule(node)
+	case *ast.AssignStmt:
+		return nil, c.executeAssign(node)
+	case *ast.ExprStmt:
+		_, _, err := c.evalExpr(node.Expr)
+		return nil, err
+	case *ast.CatchStmt:
+		return nil, c.executeCatch(node)
+	case *ast.FuncDecl:
+		if err := c.DeclareFunc(node.Name, funcDecl{
+			Name:   node.Name,
+			Params: node.Params,
+			Body:   node.Body.Stmts,
+			Info:   node.Info,
+			Env:    c,
+		}); err != nil {
+			return nil, nodeErr(ErrFuncCall, node, err)
+		}
+	case *ast.ComponentDecl:
+		if err := c.DeclareFunc(node.Name, funcDecl{
+			Name:      node.Name,
+			Params:    node.Params,
+			Body:      node.Body.Stmts,
+			Info:      node.Info,
+			Component: true,
+			Env:       c,
+		}); err != nil {
+			return nil, nodeErr(ErrFuncCall, node, err)
+		}
+	case *ast.TypeDecl:
+		if err := c.DeclareType(node.Name, typeFromDecl(node)); err != nil {
+			return nil, nodeErr(ErrInvalidType, node, err)
+		}
+	case *ast.ReturnStmt:
+		return c.executeReturn(node)
+	case *ast.BlockStmt:
+		return c.executeBlock(node)
+	case *ast.IfStmt:
+		ok, err := c.evaluateCondition(node.Cond)
+		if err != nil {
+			return nil, err
+		}
+
+		if ok {
+			return c.executeBlock(node.Then)
+		}
+
+		if node.Else != nil {
+			return c.executeStmt(node.Else)
+		}
+	case *ast.ForStmt:
+		return c.executeFor(node)
+	case *ast.ForInStmt:
+		return c.executeForIn(node)
+	case *ast.WhileStmt:
+		return c.executeWhile(node)
+	case *ast.BranchStmt:
+		if node.Continue {
+			return nil, errContinue
+		}
+		return nil, errBreak
+	}
+
+	return nil, nil
+}
+
+// executeBlock runs the statements of a block in its own block scope,
+// the variables declared in the block are not visible after it
+func (c *CodeExecuter) executeBlock(block *ast.BlockStmt) ([]*packages.FuncReturn, error) {
+	ex := NewExecuter(c.runt, c, c.file, c.namespace, "block", c.uses)
+	return ex.execute(block.Stmts)
+}
+
+// executeAssign updates a variable in the scope it was declared in,
+// or a list item, a map key or a field
+func (c *CodeExecuter) executeAssign(node *ast.AssignStmt) error {
+	ident, ok := node.Target.(*ast.IdentExpr)
+	if !ok {
+		return c.assignIndex(node)
+	}
+
+	value, typ, err := c.evalExpr(node.Value)
+	if err != nil {
+		return err
+	}
+
+	if err := c.AssignVariable(ident.Name, &variable{Type: typ, Value: value}); err != nil {
+		return nodeErr(ErrVariable, node, fmt.Errorf("cannot assign to '%s': %w", ident.Name, err))
+	}
+
+	return nil
+}
+
+// executeCatch runs a statement with the @err macro. The error of the statement
+// is stored in the err variable of the scope, it is nil if the statement succeeded.
+// A variable declared by a failed statement is nil.
+func (c *CodeExecuter) executeCatch(node *ast.CatchStmt) error {
+	c.mu.Lock()
+	old, ok := c.variables[node.Name]
+	c.mu.Unlock()
+
+	if ok && old.Const {
+		return nodeErr(ErrVariable, node, fmt.Errorf("cannot assign to '%s': %w", node.Name, ErrConstantAssignment))
+	}
+
+	errVar := &variable{Type: ast.VarNil}
+
+	if _, err := c.executeStmt(node.Stmt); err != nil {
+		if decl, ok := node.Stmt.(*ast.VarDecl); ok {
+			c.mu.Lock()
+			c.variables[decl.Name] = &variable{Type: ast.VarNil, Const: decl.Const}
+			c.mu.Unlock()
+		}
+
+		errVar = &variable{Type: ast.VarMap, Value: errorValue(err)}
+	}
+
+	c.mu.Lock()
+	c.variables[node.Name] = errVar
+	c.mu.Unlock()
+	return nil
+}
+
+// executeReturn evaluates the returned value, `return;` returns nil
+func (c *CodeExecuter) executeReturn(node *ast.ReturnStmt) ([]*packages.FuncReturn, error) {
+	if node.Value == nil {
+		return []*packages.FuncReturn{{Type: packages.VarNil}}, nil
+	}
+
+	value, typ, err := c.evalExpr(node.Value)
+	if err != nil {
+		return nil, nodeErr(ErrInvalidFuncReturn, node, err)
+	}
+
+	return []*packages.FuncReturn{{Type: toPkgType(typ), Value: value}}, nil
+}
+
+// executeFor runs a C-style for loop. The init statement is declared in a
+// loop-scoped executer and every iteration gets its own body scope, so
+// variables declared in the body do not leak between iterations.
+func (c *CodeExecuter) executeFor(node *ast.ForStmt) ([]*packages.FuncReturn, error) {
+	loopEx := NewExecuter(c.runt, c, c.file, c.namespace, "for", c.uses)
+
+	if node.Init != nil {
+		if _, err := loopEx.execute([]ast.Stmt{node.Init}); err != nil {
+			return nil, err
+		}
+	}
+
+	for {
+		if node.Cond != nil {
+			ok, err := loopEx.evaluateCondition(node.Cond)
+			if err != nil {
 				return nil, err
 			}
-		case ast.FuncDecl:
-			c.DeclareFunc(node.Name, funcDecl{
-				Args: node.Args,
-				Body: node.Children,
-			})
-		case ast.FuncReturn:
-			return c.funcGetReturn(node.Children)
-		case ast.IfStatement:
-			ok, err := c.evaluateStatement(node)
-			if err != nil {
+
+			if !ok {
+				return nil, nil
+			}
+		}
+
+		ret, stop, err := c.executeLoopBody(loopEx, node.Body.Stmts)
+		if err != nil || stop {
+			return ret, err
+		}
+
+		if node.Post != nil {
+			if _, err := loopEx.execute([]ast.Stmt{node.Post}); err != nil {
 				return nil, err
 			}
-			if ok {
-				ret, err := c.Execute(node.Children)
-				if err != nil {
-					return nil, err
-				}
-
-				if ret != nil {
-					return ret, nil
-				}
+		}
+	}
+}
+
+// executeForIn runs the body for each item of a list, map or string.
+// Maps are iterated in insertion order.
+func (c *CodeExecuter) executeForIn(node *ast.ForInStmt) ([]*packages.FuncReturn, error) {
+	if len(node.Vars) < 1 || len(node.Vars) > 2 {
+		return nil, nodeErr(ErrInvalidLoop, node, fmt.Errorf("for-in loop expects one or two variables"))
+	}
+
+	collection, typ, err := c.evalExpr(node.Collection)
+	if err != nil {
+		return nil, err
+	}
+
+	items, err := forInItems(collection, typ, len(node.Vars) == 2)
+	if err != nil {
+		return nil, exprErr(ErrInvalidLoop, node.Collection, err)
+	}
+
+	for _, vars := range items {
+		loopEx := NewExecuter(c.runt, c, c.file, c.namespace, "for", c.uses)
+
+		for j, v := range vars {
+			name := node.Vars[j]
+			if err := loopEx.DeclareVariable(name.Name, &variable{Type: toNodeType(v.Type), Value: v.Value}); err != nil {
+				return nil, nodeErr(ErrVariable, name, fmt.Errorf("cannot declare '%s': %w", name.Name, err))
 			}
-			/*case ast.ForLoop:
-			loopEx := NewExecuter(c.runt, c, c.file, c.namespace, "for", c.uses)
-			initial := node.Args[0]*/
+		}
+
+		ret, stop, err := c.executeLoopBody(loopEx, node.Body.Stmts)
+		if err != nil || stop {
+			return ret, err
 		}
 	}
 
-	if c.namespace == "main" && c.parent == nil && c.scope == "global" {
-		if _, ok := c.funcs["main"]; !ok {
+	return nil, nil
+}
+
+// executeWhile runs the body while the condition evaluates to true
+func (c *CodeExecuter) executeWhile(node *ast.WhileStmt) ([]*packages.FuncReturn, error) {
+	for {
+		ok, err := c.evaluateCondition(node.Cond)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
 			return nil, nil
 		}
 
-		_, err := c.callFunc(ast.Node{
-			Token: lexer.FuncCall,
-			Name:  "main",
-			Type:  ast.FuncCall,
-		})
-		return nil, err
+		ret, stop, err := c.executeLoopBody(c, node.Body.Stmts)
+		if err != nil || stop {
+			return ret, err
+		}
 	}
+}
 
-	return nil, nil
+// executeLoopBody runs one iteration of a loop body in its own block scope.
+// It reports whether the loop has to stop because of a break or a return.
+func (c *CodeExecuter) executeLoopBody(parent Executer, body []ast.Stmt) ([]*packages.FuncReturn, bool, error) {
+	bodyEx := NewExecuter(c.runt, parent, c.file, c.namespace, "block", c.uses)
+
+	ret, err := bodyEx.execute(body)
+	switch {
+	case errors.Is(err, errBreak):
+		return nil, true, nil
+	case errors.Is(err, errContinue):
+		return nil, false, nil
+	case err != nil:
+		return nil, true, err
+	}
+
+	return ret, ret != nil, nil
 }
@@ -0,0 +1,681 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// bufferPkg is a package that writes every argument into a buffer
+type bufferPkg struct {
+	sb *strings.Builder
+}
+
+func (b bufferPkg) Run(fn string, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	for _, arg := range args {
+		fmt.Fprint(b.sb, arg.Value)
+	}
+	return nil, nil
+}
+
+func (bufferPkg) Access(variable string) (*packages.Variable, error) {
+	return nil, errors.New("out package does not have any variables")
+}
+
+func execSource(t *testing.T, src string) (string, error) {
+	t.Helper()
+	return execWith(t, New(), src)
+}
+
+func execWith(t *testing.T, runt *Runtime, src string) (string, error) {
+	t.Helper()
+	return execFiles(t, runt, map[string]string{"main.smt": src})
+}
+
+// execFiles writes the files into a temporary directory and runs main.smt
+func execFiles(t *testing.T, runt *Runtime, files map[string]string) (string, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, src := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	file := filepath.Join(dir, "main.smt")
+
+	lx := lexer.New(file)
+	if err := lx.Parse(); err != nil {
+		return "", err
+	}
+
+	ps := ast.NewParser(lx.Tokens)
+	if err := ps.Parse(); err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	runt.With("out", bufferPkg{sb: &out})
+
+	err := runt.Run(file, ps.Nodes)
+	return out.String(), err
+}
+
+func runWith(t *testing.T, runt *Runtime, src string) string {
+	t.Helper()
+
+	out, err := execWith(t, runt, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func runSource(t *testing.T, src string) string {
+	t.Helper()
+
+	out, err := execSource(t, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func expectOutput(t *testing.T, src, want string) {
+	t.Helper()
+
+	if got := runSource(t, src); got != want {
+		t.Errorf("unexpected output\nwant: %q\ngot:  %q", want, got)
+	}
+}
+
+func TestForLoop(t *testing.T) {
+	expectOutput(t, `
+let total = 0;
+for let i = 0; i < 5; i++ {
+    total = total + i;
+}
+out.write(total);
+`, "10")
+}
+
+func TestForLoopNested(t *testing.T) {
+	expectOutput(t, `
+for let i = 0; i < 3; i++ {
+    for let j = 2; j > 0; j-- {
+        out.write(i, j, ";");
+    }
+}
+`, "02;01;12;11;22;21;")
+}
+
+func TestForLoopShadowing(t *testing.T) {
+	expectOutput(t, `
+let i = "outer";
+for let i = 0; i < 2; i++ {
+    let item = i;
+    out.write(item);
+}
+out.write(i);
+`, "01outer")
+}
+
+func TestForLoopReturn(t *testing.T) {
+	expectOutput(t, `
+func find(limit) {
+    for let i = 0; i < 10; i++ {
+        for let j = 0; j < 10; j++ {
+            if i == limit {
+                return i;
+            }
+        }
+    }
+    return -1;
+}
+
+let found = find(4);
+out.write(found);
+`, "4")
+}
+
+func TestForLoopTemplate(t *testing.T) {
+	expectOutput(t, `
+let items = "";
+for let i = 0; i < 3; i++ {
+    let item = <><li>{{ i }}</li></>;
+    items = items + item;
+}
+out.write(<><ul>{{ items }}</ul></>);
+`, "<ul><li>0</li><li>1</li><li>2</li></ul>")
+}
+
+func TestWhileLoop(t *testing.T) {
+	expectOutput(t, `
+let n = 0;
+while n < 10 {
+    n++;
+    if n == 2 {
+        continue;
+    }
+    if n > 4 {
+        if true {
+            break;
+        }
+    }
+    out.write(n);
+}
+out.write(";", n);
+`, "134;5")
+}
+
+func TestForLoopBreakContinue(t *testing.T) {
+	expectOutput(t, `
+for let i = 0; i < 3; i++ {
+    for let j = 0; j < 5; j++ {
+        if j == 1 {
+            continue;
+        }
+        if j == 3 {
+            break;
+        }
+        out.write(i, j, ";");
+    }
+}
+`, "00;02;10;12;20;22;")
+}
+
+func TestWhileLoopReturn(t *testing.T) {
+	expectOutput(t, `
+func countdown(n) {
+    while true {
+        if n == 0 {
+            return "done";
+        }
+        out.write(n);
+        n--;
+    }
+}
+
+let result = countdown(3);
+out.write(result);
+`, "321done")
+}
+
+func TestIfElseChain(t *testing.T) {
+	expectOutput(t, `
+func grade(score) {
+    if score > 89 {
+        return "A";
+    } else if score > 69 {
+        return "B";
+    } else if score > 49 {
+        out.write("!");
+    } else {
+        return "F";
+    }
+    return "C";
+}
+
+for let i = 0; i < 4; i++ {
+    let score = 95 - i * 20;
+    let g = grade(score);
+    out.write(g);
+}
+`, "AB!CF")
+}
+
+func TestIfElseRunsOneBranch(t *testing.T) {
+	expectOutput(t, `
+let x = 1;
+if x == 1 {
+    out.write("one");
+    x = 2;
+} else if x == 2 {
+    out.write("two");
+} else {
+    out.write("other");
+}
+`, "one")
+}
+
+func TestForInList(t *testing.T) {
+	expectOutput(t, `
+let list = ["a", "b", "c"];
+for item in list {
+    out.write(item);
+}
+for i, item in list {
+    if i == 1 {
+        continue;
+    }
+    out.write(";", i, item);
+}
+`, "abc;0a;2c")
+}
+
+func TestForInMap(t *testing.T) {
+	expectOutput(t, `
+let user = {"name": "John", "email": "john@example.com", "age": 30};
+user["id"] = 1;
+for key in user {
+    out.write(key, ";");
+}
+for key, value in user {
+    if key == "age" {
+        break;
+    }
+    out.write(<><b>{{ key }}</b>{{ value }}</>);
+}
+`, "name;email;age;id;<b>name</b>John<b>email</b>john@example.com")
+}
+
+func TestForInString(t *testing.T) {
+	expectOutput(t, `
+for ch in "hé" {
+    out.write(ch, ";");
+}
+for i, ch in "abc" {
+    out.write(i, ch);
+}
+`, "h;é;0a1b2c")
+}
+
+func TestForInReturn(t *testing.T) {
+	expectOutput(t, `
+func find(users, name) {
+    for user in users {
+        if user.name == name {
+            return user.id;
+        }
+    }
+    return nil;
+}
+
+let users = [{"id": 1, "name": "a"}, {"id": 2, "name": "b"}];
+out.write(find(users, "b"), find(users, "c"));
+`, "2<nil>")
+}
+
+func TestForInErrors(t *testing.T) {
+	_, err := execSource(t, `for x in 5 { }`)
+	if err == nil || !strings.Contains(err.Error(), "cannot iterate over number") {
+		t.Errorf("expected an iteration error, got %v", err)
+	}
+}
+
+func TestTemplateExpressions(t *testing.T) {
+	expectOutput(t, `
+use strs;
+
+func greet(name) {
+    return "Hi " + name;
+}
+
+let user = {"name": "  John  ", "roles": ["admin"]};
+let count = 2;
+out.write(<>{{ strs.trim(user.name) }}: {{ count + 1 }}, {{ user.roles[0] }}, {{greet("Jane")}}, {{ count > 1 && true }}</>);
+`, "John: 3, admin, Hi Jane, true")
+}
+
+func TestTemplateErrorPosition(t *testing.T) {
+	// Templates are compiled by the parser, so a syntax error
+	// of an interpolation is a parse error
+	_, err := execSource(t, "let count = 1;\nlet t = <>\n  <p>{{ count }}</p>\n  <b>{{  count +  }}</b>\n</>;")
+
+	var posErr ast.ErrWithPos
+	if !errors.As(err, &posErr) {
+		t.Fatalf("parse error: expected a positioned error, got %v", err)
+	}
+
+	if posErr.Pos.Line != 4 || posErr.Pos.Pos != 16 {
+		t.Errorf("parse error: expected error at 4:16, got %d:%d", posErr.Pos.Line, posErr.Pos.Pos)
+	}
+
+	_, err = execSource(t, "let t = <><p>{{ nope }}</p></>;")
+
+	var nodeError *NodeError
+	if !errors.As(err, &nodeError) {
+		t.Fatalf("eval error: expected a node error, got %v", err)
+	}
+
+	// Positions point to the first character of the token
+	if nodeError.Info.Line != 1 || nodeError.Info.Pos != 17 {
+		t.Errorf("eval error: expected error at 1:17, got %d:%d", nodeError.Info.Line, nodeError.Info.Pos)
+	}
+}
+
+func TestLiterals(t *testing.T) {
+	expectOutput(t, `
+let s = "tab:\t, quote:\", hex:\x41, unicode:\u00e9";
+out.write(s, ";", 'it\'s', ";", 0x10 + 1, ";", 1.5e2);
+`, "tab:\t, quote:\", hex:A, unicode:é;it's;17;150")
+}
+
+func TestErrorStackTrace(t *testing.T) {
+	_, err := execSource(t, `func inner(x) {
+    return x + [1];
+}
+
+func outer(x) {
+    return inner(x);
+}
+
+func main() {
+    outer(1);
+}
+`)
+
+	var nodeError *NodeError
+	if !errors.As(err, &nodeError) {
+		t.Fatalf("expected a node error, got %v", err)
+	}
+
+	var names []string
+	for _, f := range nodeError.Stack {
+		names = append(names, fmt.Sprintf("%s@%d:%d", f.Name, f.Pos.Line, f.Pos.Pos))
+	}
+
+	if got := strings.Join(names, " "); got != "inner@6:12 outer@10:5 main@0:0" {
+		t.Errorf("unexpected stack trace: %s", got)
+	}
+
+	// The plain report has the source line, the carets under the
+	// binary expression and the stack trace without colors
+	report := nodeError.Render(false)
+	for _, want := range []string{"2 |     return x + [1];\n  |            ^^^^^^^\n", "at outer() called from ", "at main()\n"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the report, got:\n%s", want, report)
+		}
+	}
+
+	if strings.Contains(report, "\x1b[") {
+		t.Errorf("expected a plain report, got:\n%s", report)
+	}
+}
+
+func TestErrMacro(t *testing.T) {
+	expectOutput(t, `
+let a = 10 / 0 @err;
+out.write(a, ";", err.code, ";", err.message, ";");
+
+func check() {
+    out.write(1 + 1) @err;
+    out.write(err, ";");
+}
+check();
+out.write(err.message);
+`, "<nil>;invalid expression;division by zero;2<nil>;division by zero")
+
+	_, err := execSource(t, `
+func fail() {
+    return [1] + 1;
+}
+
+fail() @err;
+fail();
+`)
+
+	var nodeError *NodeError
+	if !errors.As(err, &nodeError) || nodeError.Info.Line != 3 {
+		t.Errorf("expected the uncaught error to stop the code, got %v", err)
+	}
+
+	// The resolver reports a constant err, the runtime checks it too
+	var nodes []ast.Stmt
+	for _, src := range []string{`const err = 1;`, `out.write(1) @err;`} {
+		tokens, err := lexer.Tokenize("main.smt", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ps := ast.NewParser(tokens)
+		if err := ps.Parse(); err != nil {
+			t.Fatal(err)
+		}
+		nodes = append(nodes, ps.Nodes...)
+	}
+
+	runt := New()
+	runt.With("out", bufferPkg{sb: &strings.Builder{}})
+	if err := runt.Run("main.smt", nodes); err == nil || !strings.Contains(err.Error(), "cannot assign to 'err': cannot reassign constant") {
+		t.Errorf("expected a constant error, got %v", err)
+	}
+}
+
+func TestFunctionValues(t *testing.T) {
+	expectOutput(t, `
+let double = func(x) { return x * 2; };
+
+func apply(fn, items) {
+    let result = "";
+    for item in items {
+        result = result + fn(item) + ",";
+    }
+    return result;
+}
+
+func square(x) {
+    return x * x;
+}
+
+out.write(double(4), ";", apply(double, [1, 2]), ";", apply(square, [3]), ";");
+out.write(type(double), ";", double, ";", func(a, b) { return a + b; }(1, 2), ";");
+
+let handlers = {"click": func(e) { return "clicked " + e; }};
+out.write(handlers.click("a"), ";", handlers["click"]("b"));
+`, "8;2,4,;9,;func;func(x);3;clicked a;clicked b")
+}
+
+// callbackPkg calls the function it gets with the rest of the arguments
+type callbackPkg struct{}
+
+func (callbackPkg) Run(fn string, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	f, ok := args[0].Value.(packages.Func)
+	if !ok || args[0].Type != packages.VarFunc {
+		return nil, fmt.Errorf("expected a function, got %s", args[0].Type)
+	}
+	return f.Call(args[1:]...)
+}
+
+func (callbackPkg) Access(variable string) (*packages.Variable, error) {
+	return nil, errors.New("callback package does not have any variables")
+}
+
+func TestClosures(t *testing.T) {
+	runt := New()
+	runt.With("callback", callbackPkg{})
+
+	out := runWith(t, runt, `
+func counter() {
+    let n = 0;
+    return func() {
+        n = n + 1;
+        return n;
+    };
+}
+
+let next = counter();
+let other = counter();
+out.write(next(), next(), other(), next(), ";");
+
+let total = 0;
+let add = func(x) { total = total + x; };
+add(2);
+callback.call(add, 3);
+out.write(total, ";", callback.call(func(a, b) { return a * b; }, 4, 5));
+`)
+
+	if out != "1213;5;20" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	_, err := execWith(t, runt, `let fns = [1];
+fns[0]();
+`)
+	if err == nil || !strings.Contains(err.Error(), "number value is not callable") {
+		t.Errorf("expected a not callable error, got %v", err)
+	}
+}
+
+func TestObjects(t *testing.T) {
+	runt := New()
+	runt.With("callback", callbackPkg{})
+
+	out := runWith(t, runt, `
+type User { name, email, }
+
+func User#greet(u, greeting) {
+    return greeting + ", " + u.name;
+}
+
+func User#rename(u, name) {
+    u.name = name;
+}
+
+let user = User("John", "john@example.com");
+out.write(user.greet("Hello"), ";", user.name, ";");
+
+user.rename("Jane");
+user.email = nil;
+out.write(user, ";", type(user), ";", User("Bob").email, ";");
+
+let keys = func(m) {
+    let names = "";
+    for key, value in m {
+        names = names + key + ":" + type(value) + ",";
+    }
+    return names;
+};
+out.write(callback.call(keys, user));
+`)
+
+	if want := `Hello, John;John;{"name": "Jane", "email": nil};User;<nil>;name:string,email:nil,`; out != want {
+		t.Errorf("unexpected output\nwant: %q\ngot:  %q", want, out)
+	}
+
+	tests := map[string]string{
+		`type User { name } let u = User(); u.age = 1;`:    "User does not have a field 'age'",
+		`type User { name } let u = User(1, 2);`:           "User has 1 fields, got 2 values",
+		`func f() { type Point { x, y } } f(); f();`:       "type is only allowed at the top level of a file",
+		`type User { name } out.write(User("a").missing);`: "User does not have a field 'missing'",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestBlockScopes(t *testing.T) {
+	expectOutput(t, `
+let x = 1;
+if true {
+    let x = 2;
+    let y = 3;
+    out.write(x, y, ";");
+    let z = 10 / 0 @err;
+} else {
+    let y = 4;
+}
+
+out.write(x, ";");
+
+if false {
+} else {
+    let x = 5;
+    x = 6;
+}
+out.write(x);
+`, "23;1;1")
+
+	// The err of the @err macro does not leak out of the block
+	_, err := execSource(t, `
+if true {
+    let a = 10 / 0 @err;
+}
+out.write(err);
+`)
+	if err == nil || !strings.Contains(err.Error(), "invalid variable reference: 'err'") {
+		t.Errorf("expected err to be undeclared, got %v", err)
+	}
+}
+
+func TestConstAssignment(t *testing.T) {
+	// Imported files run in a child of the importing scope,
+	// the constants are checked when the code runs too
+	_, err := execFiles(t, New(), map[string]string{
+		"main.smt": `import("lib.smt"); const limit = 1; set();`,
+		"lib.smt":  `func set() { limit = 2; }`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "cannot assign to 'limit': cannot reassign constant") {
+		t.Errorf("expected a constant error, got %v", err)
+	}
+}
+
+func TestFuncRedeclaration(t *testing.T) {
+	expectOutput(t, `
+func f() {
+    func g() { return 1; }
+    return g();
+}
+out.write(f(), f());
+`, "11")
+
+	_, err := execSource(t, `
+func f() { return 1; }
+func f() { return 2; }
+`)
+	if err == nil || !strings.Contains(err.Error(), "function f() already declared") {
+		t.Errorf("expected a redeclaration error, got %v", err)
+	}
+
+	_, err = execFiles(t, New(), map[string]string{
+		"main.smt": `func f() { return 1; } import("lib.smt");`,
+		"lib.smt":  `func f() { return 2; }`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "function f() already declared") {
+		t.Errorf("expected a redeclaration error for the imported file, got %v", err)
+	}
+}
+
+func TestFuncScope(t *testing.T) {
+	// Functions see the variables of their declaration, not of their caller
+	expectOutput(t, `
+func apply(fn) {
+    let prefix = "caller";
+    return fn("!");
+}
+
+func outer() {
+    let prefix = "outer";
+    func inner(s) { return prefix + s; }
+    return apply(inner);
+}
+
+out.write(outer());
+`, "outer!")
+
+	_, err := execSource(t, `
+func f() { return y; }
+func g() { let y = 5; return f(); }
+g();
+`)
+	if err == nil || !strings.Contains(err.Error(), "invalid variable reference: 'y'") {
+		t.Errorf("expected y to be undeclared in f, got %v", err)
+	}
+}
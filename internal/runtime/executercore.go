@@ -2,453 +2,227 @@ package runtime
 
 import (
 	"fmt"
-	"strconv"
+	"io"
 	"strings"
 
-	"github.com/Knetic/govaluate"
 	"github.com/bndrmrtn/smarti/internal/ast"
 	"github.com/bndrmrtn/smarti/internal/packages"
 )
 
-func (c *CodeExecuter) createVariable(node ast.Node, ret ...bool) (interface{}, ast.NodeType, error) {
-	var value interface{}
-
-	switch node.Type {
-	case ast.VarNil:
-		value = nil
-	case ast.VarString, ast.VarSingleString:
-		value = node.Value
-	case ast.VarNumber:
-		v, err := strconv.Atoi(node.Value)
-		if err != nil {
-			return nil, ast.VarUnknown, nodeErr(ErrVariable, node, fmt.Errorf("invalid number: %v", node.Value))
-		}
-		value = v
-		break
-	case ast.VarFloat:
-		v, err := strconv.ParseFloat(node.Value, 64)
-		if err != nil {
-			return nil, ast.VarUnknown, nodeErr(ErrVariable, node, fmt.Errorf("invalid float: %v", node.Value))
-		}
-		value = v
-		break
-	case ast.VarBool:
-		v, err := strconv.ParseBool(node.Value)
-		if err != nil {
-			return nil, ast.VarUnknown, nodeErr(ErrVariable, node, fmt.Errorf("invalid boolean: %v", node.Value))
-		}
-		value = v
-		break
-	case ast.VarExpression:
-		v, typ, err := c.evaluateExpression(node)
-		if err != nil {
-			return nil, ast.VarUnknown, err
-		}
-		node.Type = typ
-		value = v
-		break
-	case ast.FuncCall:
-		v, err := c.callFunc(node)
-		if err != nil {
-			return nil, ast.VarUnknown, err
-		}
-
-		if len(v) == 0 {
-			value = nil
-			node.Type = ast.VarNil
-			break
-		}
+func (c *CodeExecuter) callFunc(call *ast.CallExpr) ([]*packages.FuncReturn, error) {
+	if member, ok := call.Callee.(*ast.MemberExpr); ok && !c.isPackageCall(member) {
+		return c.callMethod(call, member)
+	}
 
-		value = v[0].Value
-		node.Type = toNodeType(v[0].Type)
-		break
-	case ast.VarVariable:
-		v, err := c.GetVariable(node.Value)
+	name, ok := ast.CalleeName(call.Callee)
+	if !ok {
+		v, err := c.funcGetArgs(call.Args)
 		if err != nil {
-			return nil, ast.VarUnknown, nodeErr(ErrVariable, node, fmt.Errorf("invalid variable reference: '%v'", node.Value))
+			return nil, err
 		}
-		node.Type = v.Type
-		value = v.Value
-	case ast.VarTemplate:
-		v, err := c.evaluateTemplate(node)
-		if err != nil {
-			return nil, ast.VarUnknown, err
-		}
-		value = v
-		node.Type = ast.VarString
-	}
-
-	if len(ret) > 0 && ret[0] {
-		return value, node.Type, nil
+		return c.callValue(call, v)
 	}
 
-	c.mu.Lock()
-	c.variables[node.Name] = &variable{
-		Type:  node.Type,
-		Ref:   node.IsReference,
-		Value: value,
+	if w, lit, ok := c.streamTarget(name, call.Args); ok {
+		return nil, c.streamTemplate(lit, w)
 	}
-	c.mu.Unlock()
 
-	return nil, node.Type, nil
-}
-
-func (c *CodeExecuter) callFunc(node ast.Node) ([]*packages.FuncReturn, error) {
-	v, err := c.funcGetArgs(node.Args)
+	v, err := c.funcGetArgs(call.Args)
 	if err != nil {
 		return nil, err
 	}
 
-	if strings.Contains(node.Name, ".") {
-		parts := strings.Split(node.Name, ".")
-		vari, ok := c.variables[parts[0]]
-		if ok {
-			if fn, ok := c.funcs[string(vari.Type)+"#"+parts[1]]; ok {
-				ex, nodes, err := c.runt.Executer(c.file, true, c, "func", c.GetPackages(), fn.Body)
-				if err != nil {
-					return nil, nodeErr(ErrFuncCall, node, err)
-				}
-
-				v = append([]*variable{vari}, v...)
-
-				if len(fn.Args) != len(v) {
-					return nil, nodeErr(ErrFuncCall, node, fmt.Errorf("invalid number of arguments. expected %d, got %d", len(fn.Args), len(v)))
-				}
-
-				for i, arg := range fn.Args {
-					err := ex.DeclareVariable(arg.Value, v[i])
-					if err != nil {
-						return nil, nodeErr(ErrFuncCall, node, err)
-					}
-				}
-
-				ret, err := ex.Execute(nodes)
-				if err != nil {
-					return nil, err
-				}
-
-				if len(ret) == 0 {
-					return nil, nil
-				}
-
-				if len(ret) != 1 {
-					return nil, nodeErr(ErrFuncCall, node, fmt.Errorf("type function must return a single value"))
-				}
-
-				vari.Type = ast.NodeType(ret[0].Type)
-				vari.Value = ret[0].Value
-				return nil, nil
-			}
-		}
-
+	if strings.Contains(name, ".") {
+		parts := strings.Split(name, ".")
 		pkg, ok := c.uses[parts[0]]
 		if !ok {
-			return nil, nodeErr(ErrPackageNotImported, node, fmt.Errorf("package %s not imported", parts[0]))
+			return nil, exprErr(ErrPackageNotImported, call, fmt.Errorf("package %s not imported", parts[0]))
 		}
-		return pkg.Run(parts[1], toPkgVar(v))
-	}
 
-	fn, ok := c.funcs[node.Name]
-	if ok {
-		ex, nodes, err := c.runt.Executer(c.file, true, c, "func", c.GetPackages(), fn.Body)
-		if err != nil {
-			return nil, nodeErr(ErrFuncCall, node, err)
-		}
-
-		if len(fn.Args) != len(v) {
-			return nil, nodeErr(ErrFuncCall, node, fmt.Errorf("invalid number of arguments. expected %d, got %d", len(fn.Args), len(v)))
-		}
-
-		for i, arg := range fn.Args {
-			err := ex.DeclareVariable(arg.Value, v[i])
+		if m, ok := pkg.(*module); ok {
+			ret, err := m.call(parts[1], v, call.Pos())
 			if err != nil {
-				return nil, nodeErr(ErrFuncCall, node, err)
+				return nil, exprErr(ErrFuncCall, call, err)
 			}
+			return ret, nil
 		}
 
-		return ex.Execute(nodes)
+		ret, err := pkg.Run(parts[1], toPkgArgs(v))
+		if err != nil {
+			return nil, exprErr(ErrFuncCall, call, err)
+		}
+		return ret, nil
 	}
 
-	if c.parent != nil {
-		return c.parent.callFunc(node)
+	if vari, err := c.GetVariable(name); err == nil && vari.Type == ast.VarFunc {
+		return c.callValue(call, v)
 	}
 
-	return c.ExecuteBuiltinMethod(c, node.Name, toPkgVar(v))
-}
-
-func (c *CodeExecuter) funcGetArgs(nodes []ast.Node) ([]*variable, error) {
-	args := make([]*variable, len(nodes))
-	for i, node := range nodes {
-		switch node.Type {
-		case ast.VarVariable:
-			v, err := c.GetVariable(node.Value)
-			if err != nil {
-				return nil, nodeErr(ErrInvalidFuncArgument, node, fmt.Errorf("invalid variable reference: '%v'", node.Value))
-			}
-			args[i] = v
-		default:
-			v, t, err := c.createVariable(node, true)
-			if err != nil {
-				return nil, nodeErr(ErrInvalidFuncArgument, node, err)
-			}
-			args[i] = &variable{
-				Type:  t,
-				Value: v,
-			}
-		}
+	fn, ok := c.lookupFunc(name)
+	if ok {
+		return c.callDecl(fn, v, call.Pos())
 	}
-	return args, nil
-}
 
-func (c *CodeExecuter) funcGetReturn(nodes []ast.Node) ([]*packages.FuncReturn, error) {
-	var returns []*packages.FuncReturn
-
-	for _, v := range nodes {
-		val, t, err := c.createVariable(v, true)
+	if decl, ok := c.lookupType(name); ok {
+		ret, err := construct(decl, v)
 		if err != nil {
-			return nil, nodeErr(ErrInvalidFuncReturn, v, err)
+			return nil, exprErr(ErrFuncCall, call, err)
 		}
-
-		returns = append(returns, &packages.FuncReturn{
-			Type:  toPkgType(t),
-			Value: val,
-		})
+		return ret, nil
 	}
 
-	return returns, nil
-}
-
-/*
-func (c *CodeExecuter) evaluateExpression(node ast.Node) (interface{}, ast.NodeType, error) {
-	if node.Type != ast.VarExpression {
-		return nil, ast.VarNil, ErrNotExpression
+	ret, err := c.ExecuteBuiltinMethod(c, name, toPkgVar(v))
+	if err != nil {
+		return nil, exprErr(ErrFuncCall, call, err)
 	}
+	return ret, nil
+}
 
-	type expr struct {
-		Op    bool
-		Value interface{}
+// isPackageCall reports whether the callee is a function of a package: strs.trim(s).
+// Variables shadow the packages of the same name.
+func (c *CodeExecuter) isPackageCall(member *ast.MemberExpr) bool {
+	ident, ok := member.Object.(*ast.IdentExpr)
+	if !ok {
+		return false
 	}
 
-	var (
-		result []expr
-		typ    ast.NodeType
-	)
-
-	for _, n := range node.Children {
-		switch n.Type {
-		case ast.VarOperator:
-			if typ == "" {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("operator cannot come before value"))
-			}
-
-			if len(result) > 0 && result[len(result)-1].Op {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("two operators cannot follow each other"))
-			}
-
-			result = append(result, expr{
-				Op:    true,
-				Value: n.Value,
-			})
-		default:
-			v, t, err := c.createVariable(n, true)
-			if err != nil {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, err)
-			}
-
-			if typ == "" {
-				typ = t
-			}
-
-			if typ != t {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("mismatched types in expression: %s vs %s", typ, t))
-			}
+	_, err := c.GetVariable(ident.Name)
+	return err != nil
+}
 
-			result = append(result, expr{
-				Op:    false,
-				Value: v,
-			})
-		}
+// callMethod calls a method of a value: value.name(args). The methods declared
+// in Smarti as func type#name take precedence over the methods of the runtime.
+// A function stored in a field of a map or an object is called too.
+func (c *CodeExecuter) callMethod(call *ast.CallExpr, member *ast.MemberExpr) ([]*packages.FuncReturn, error) {
+	recv, typ, err := c.evalExpr(member.Object)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(result) == 1 {
-		return result[0].Value, typ, nil
+	args, err := c.funcGetArgs(call.Args)
+	if err != nil {
+		return nil, err
 	}
 
-	var (
-		compare bool
-		out     interface{}
-		i       int
-	)
+	if fn, ok := c.lookupFunc(methodName(typ, member.Name)); ok {
+		return c.callDecl(fn, append([]*variable{{Type: typ, Value: recv}}, args...), call.Pos())
+	}
 
-	for i+2 < len(result) {
-		if result[i].Op || !result[i+1].Op || result[i+2].Op {
-			return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("invalid expression structure"))
+	if fn, ok := c.runt.method(toPkgType(typ), member.Name); ok {
+		ret, err := fn(&packages.Variable{Type: toPkgType(typ), Value: recv}, toPkgVar(args))
+		if err != nil {
+			return nil, exprErr(ErrFuncCall, call, err)
 		}
 
-		left, right := result[i].Value, result[i+2].Value
-
-		switch typ {
-		case ast.VarNumber:
-			leftVal, leftOk := left.(int)
-			rightVal, rightOk := right.(int)
-			if !leftOk || !rightOk {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("invalid number operands"))
-			}
-
-			switch result[i+1].Value {
-			case "+":
-				out = leftVal + rightVal
-			case "-":
-				out = leftVal - rightVal
-			case "*":
-				out = leftVal * rightVal
-			case "/":
-				if rightVal == 0 {
-					return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("division by zero"))
-				}
-				out = leftVal / rightVal
-			case "==":
-				out = leftVal == rightVal
-				compare = true
-			case "!=":
-				out = leftVal != rightVal
-				compare = true
-			default:
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("unsupported operator: %v", result[i+1].Value))
-			}
-
-		case ast.VarString, ast.VarSingleString:
-			leftVal, leftOk := left.(string)
-			rightVal, rightOk := right.(string)
-			if !leftOk || !rightOk {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("invalid string operands"))
-			}
-
-			switch result[i+1].Value {
-			case "+":
-				out = leftVal + rightVal
-			case "-":
-				out = strings.ReplaceAll(leftVal, rightVal, "")
-			case "==":
-				out = leftVal == rightVal
-				compare = true
-			case "!=":
-				out = leftVal != rightVal
-				compare = true
-			default:
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("unsupported operator: %v", result[i+1].Value))
-			}
-
-		case ast.VarBool:
-			leftVal, leftOk := left.(bool)
-			rightVal, rightOk := right.(bool)
-			if !leftOk || !rightOk {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("invalid boolean operands"))
-			}
-
-			switch result[i+1].Value {
-			case "==":
-				out = leftVal == rightVal
-				compare = true
-			case "!=":
-				out = leftVal != rightVal
-				compare = true
-			default:
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("unsupported operator for booleans: %v", result[i+1].Value))
-			}
-
-		default:
-			return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("unsupported type: %v", typ))
+		if ret == nil {
+			return nil, nil
 		}
+		return []*packages.FuncReturn{{Type: ret.Type, Value: ret.Value}}, nil
+	}
 
-		result = append(result[:i], expr{Op: false, Value: out})
-		result = append(result, result[i+1:]...)
+	// A function in a field: handlers.click(event)
+	if field, err := getMember(recv, typ, member.Name); err == nil {
+		if fn, ok := field.Value.(*closure); ok {
+			return fn.call(args, call.Pos())
+		}
 	}
 
-	if compare {
-		typ = ast.VarBool
+	return nil, exprErr(ErrFuncCall, call, fmt.Errorf("%s value does not have a method '%s'", typ, member.Name))
+}
+
+// callValue calls the function value the callee evaluates to, like a closure in a variable
+func (c *CodeExecuter) callValue(call *ast.CallExpr, args []*variable) ([]*packages.FuncReturn, error) {
+	value, typ, err := c.evalExpr(call.Callee)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(result) == 1 {
-		return result[0].Value, typ, nil
+	fn, ok := value.(*closure)
+	if !ok {
+		return nil, exprErr(ErrFuncCall, call, fmt.Errorf("%s value is not callable", typ))
 	}
 
-	return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, fmt.Errorf("incomplete expression"))
+	return fn.call(args, call.Pos())
 }
-*/
 
-func (c *CodeExecuter) evaluateExpression(node ast.Node) (interface{}, ast.NodeType, error) {
-	if node.Type != ast.VarExpression {
-		return nil, ast.VarNil, nodeErr(ErrNotExpression, node, fmt.Errorf("node %s is not an expression", node.Name))
+// callDecl calls a Smarti function with evaluated arguments
+func (c *CodeExecuter) callDecl(fn funcDecl, args []*variable, info ast.NodeFileInfo) ([]*packages.FuncReturn, error) {
+	// A declared function does not see the variables of its caller
+	if fn.Env != nil && fn.Env != Executer(c) {
+		return fn.Env.callDecl(fn, args, info)
 	}
 
-	var expressionList []string
-	var args = make(map[string]interface{})
+	ex, nodes, err := c.runt.Executer(c.file, true, c, "func", c.GetPackages(), fn.Body)
+	if err != nil {
+		return nil, infoErr(ErrFuncCall, info, err)
+	}
 
-	for _, n := range node.Children {
-		switch n.Type {
-		case ast.VarOperator:
-			expressionList = append(expressionList, n.Value)
-		default:
-			v, t, err := c.createVariable(n, true)
-			if err != nil {
-				return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, err)
-			}
+	if len(fn.Params) != len(args) {
+		return nil, infoErr(ErrFuncCall, info, fmt.Errorf("invalid number of arguments. expected %d, got %d", len(fn.Params), len(args)))
+	}
 
-			switch t {
-			case ast.VarNumber:
-				expressionList = append(expressionList, strconv.Itoa(v.(int)))
-			case ast.VarString, ast.VarSingleString:
-				expressionList = append(expressionList, strconv.Quote(v.(string)))
-			case ast.VarBool:
-				expressionList = append(expressionList, strconv.FormatBool(v.(bool)))
-			}
+	for i, arg := range fn.Params {
+		err := ex.DeclareVariable(arg.Name, args[i])
+		if err != nil {
+			return nil, infoErr(ErrFuncCall, info, err)
 		}
 	}
 
-	expression, err := govaluate.NewEvaluableExpression(strings.Join(expressionList, " "))
+	ret, err := ex.Execute(nodes)
 	if err != nil {
-		return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, err)
+		return nil, withFrame(err, fn.Name, info)
 	}
+	return ret, nil
+}
 
-	result, err := expression.Evaluate(args)
-	if err != nil {
-		return nil, ast.VarUnknown, nodeErr(ErrInvalidExpression, node, err)
+func (c *CodeExecuter) funcGetArgs(args []ast.Expr) ([]*variable, error) {
+	vars := make([]*variable, len(args))
+	for i, arg := range args {
+		v, t, err := c.evalExpr(arg)
+		if err != nil {
+			return nil, exprErr(ErrInvalidFuncArgument, arg, err)
+		}
+		vars[i] = &variable{
+			Type:  t,
+			Value: v,
+		}
 	}
-
-	return result, getType(result), nil
+	return vars, nil
 }
 
-func (c *CodeExecuter) evaluateTemplate(node ast.Node) (string, error) {
-	parts := parseTemplate(node.Value)
+func (c *CodeExecuter) evaluateTemplate(lit *ast.LiteralExpr) (string, error) {
 	var sb strings.Builder
+	if err := c.renderTemplate(lit, &sb); err != nil {
+		return "", err
+	}
 
-	for _, part := range parts {
-		if part.Static {
-			sb.WriteString(part.Content)
-			continue
-		}
-		v, err := c.GetVariable(part.Content)
+	return sb.String(), nil
+}
+
+// renderTemplate renders the template into the writer. The templates
+// with blocks of a file that extends a layout are rendered with the layout.
+func (c *CodeExecuter) renderTemplate(lit *ast.LiteralExpr, w io.Writer) error {
+	r := &templateRenderer{c: c, info: lit.Info, state: c.templateState(), out: w}
+	if r.state.layout != "" && hasBlocks(lit.Template) {
+		content, err := r.renderLayout(c, lit.Template)
 		if err != nil {
-			return "", nodeErr(ErrInvalidTemplate, node, err)
+			return err
 		}
-		sb.WriteString(fmt.Sprint(v.Value))
+		return r.write(content)
 	}
 
-	return sb.String(), nil
+	return r.render(c, lit.Template)
 }
 
-func (c *CodeExecuter) evaluateStatement(node ast.Node) (bool, error) {
-	ok, typ, err := c.evaluateExpression(ast.Node{
-		Type:     ast.VarExpression,
-		Children: node.Args,
-	})
+// evaluateCondition evaluates the node and makes sure that it is a boolean
+func (c *CodeExecuter) evaluateCondition(cond ast.Expr) (bool, error) {
+	ok, typ, err := c.evalExpr(cond)
 	if err != nil {
 		return false, err
 	}
 
 	if typ != ast.VarBool {
-		return false, nodeErr(ErrInvalidExpression, node, fmt.Errorf("invald expression output"))
+		return false, exprErr(ErrInvalidExpression, cond, fmt.Errorf("condition must be a boolean, got %s", typ))
 	}
 
 	return ok.(bool), nil
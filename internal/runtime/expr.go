@@ -0,0 +1,348 @@
+package runtime
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+)
+
+// evalExpr evaluates an expression tree in the executer's scope
+func (c *CodeExecuter) evalExpr(e ast.Expr) (interface{}, ast.NodeType, error) {
+	switch e := e.(type) {
+	case *ast.LiteralExpr:
+		return c.evalLiteral(e)
+	case *ast.IdentExpr:
+		v, err := c.GetVariable(e.Name)
+		if err != nil {
+			// A declared function can be used as a value
+			if fn, ok := c.lookupFunc(e.Name); ok {
+				return &closure{decl: fn, env: c}, ast.VarFunc, nil
+			}
+			return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("invalid variable reference: '%v'", e.Name))
+		}
+		return v.Value, v.Type, nil
+	case *ast.FuncExpr:
+		fn := funcDecl{Name: "anonymous", Params: e.Params, Body: e.Body.Stmts}
+		return &closure{decl: fn, env: c}, ast.VarFunc, nil
+	case *ast.MemberExpr:
+		return c.evalMember(e)
+	case *ast.CallExpr:
+		ret, err := c.callFunc(e)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		if len(ret) == 0 {
+			return nil, ast.VarNil, nil
+		}
+		return ret[0].Value, toNodeType(ret[0].Type), nil
+	case *ast.IndexExpr:
+		return c.evalIndex(e)
+	case *ast.ListExpr:
+		return c.evalList(e)
+	case *ast.MapExpr:
+		return c.evalMap(e)
+	case *ast.UnaryExpr:
+		return c.evalUnary(e)
+	case *ast.BinaryExpr:
+		return c.evalBinary(e)
+	case nil:
+		return nil, ast.VarUnknown, ErrNotExpression
+	}
+
+	return nil, ast.VarUnknown, exprErr(ErrInvalidExpression, e, fmt.Errorf("unsupported expression %T", e))
+}
+
+func (c *CodeExecuter) evalLiteral(e *ast.LiteralExpr) (interface{}, ast.NodeType, error) {
+	switch e.Type {
+	case ast.VarNil:
+		return nil, ast.VarNil, nil
+	case ast.VarString, ast.VarSingleString:
+		return e.Value, e.Type, nil
+	case ast.VarNumber:
+		v, err := strconv.Atoi(e.Value)
+		if err != nil {
+			return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("invalid number: %v", e.Value))
+		}
+		return v, ast.VarNumber, nil
+	case ast.VarFloat:
+		v, err := strconv.ParseFloat(e.Value, 64)
+		if err != nil {
+			return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("invalid float: %v", e.Value))
+		}
+		return v, ast.VarFloat, nil
+	case ast.VarBool:
+		v, err := strconv.ParseBool(e.Value)
+		if err != nil {
+			return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("invalid boolean: %v", e.Value))
+		}
+		return v, ast.VarBool, nil
+	case ast.VarTemplate:
+		v, err := c.evaluateTemplate(e)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+		return v, ast.VarSafe, nil
+	}
+
+	return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("unknown literal: %v", e.Value))
+}
+
+// evalMember resolves `object.name`. Packages expose their variables this way,
+// collections their length and maps their keys.
+func (c *CodeExecuter) evalMember(e *ast.MemberExpr) (interface{}, ast.NodeType, error) {
+	if ident, ok := e.Object.(*ast.IdentExpr); ok {
+		if _, err := c.GetVariable(ident.Name); err != nil {
+			pkg, err := c.GetPackage(ident.Name)
+			if err != nil {
+				return nil, ast.VarUnknown, exprErr(ErrVariable, e, fmt.Errorf("invalid reference: '%s' is not a variable or an imported package", ident.Name))
+			}
+
+			v, err := pkg.Access(e.Name)
+			if err != nil {
+				return nil, ast.VarUnknown, exprErr(ErrVariable, e, err)
+			}
+			return v.Value, toNodeType(v.Type), nil
+		}
+	}
+
+	obj, typ, err := c.evalExpr(e.Object)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	v, err := getMember(obj, typ, e.Name)
+	if err != nil {
+		return nil, ast.VarUnknown, exprErr(ErrInvalidIndex, e, err)
+	}
+
+	return v.Value, toNodeType(v.Type), nil
+}
+
+func (c *CodeExecuter) evalUnary(e *ast.UnaryExpr) (interface{}, ast.NodeType, error) {
+	v, typ, err := c.evalExpr(e.Operand)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	switch {
+	case e.Operator == "-" && typ == ast.VarNumber:
+		return -v.(int), ast.VarNumber, nil
+	case e.Operator == "-" && typ == ast.VarFloat:
+		return -v.(float64), ast.VarFloat, nil
+	case e.Operator == "!" && typ == ast.VarBool:
+		return !v.(bool), ast.VarBool, nil
+	}
+
+	return nil, ast.VarUnknown, exprErr(ErrInvalidExpression, e, fmt.Errorf("operator %s is not supported on %s", e.Operator, typ))
+}
+
+func (c *CodeExecuter) evalBinary(e *ast.BinaryExpr) (interface{}, ast.NodeType, error) {
+	left, lt, err := c.evalExpr(e.Left)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	// Logical operators only evaluate the right side when it is needed
+	if e.Operator == "&&" || e.Operator == "||" {
+		if lt != ast.VarBool {
+			return nil, ast.VarUnknown, exprErr(ErrInvalidExpression, e, fmt.Errorf("operator %s expects booleans, got %s", e.Operator, lt))
+		}
+
+		if (e.Operator == "&&" && !left.(bool)) || (e.Operator == "||" && left.(bool)) {
+			return left, ast.VarBool, nil
+		}
+
+		right, rt, err := c.evalExpr(e.Right)
+		if err != nil {
+			return nil, ast.VarUnknown, err
+		}
+
+		if rt != ast.VarBool {
+			return nil, ast.VarUnknown, exprErr(ErrInvalidExpression, e, fmt.Errorf("operator %s expects booleans, got %s", e.Operator, rt))
+		}
+		return right, ast.VarBool, nil
+	}
+
+	right, rt, err := c.evalExpr(e.Right)
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	var (
+		value interface{}
+		typ   ast.NodeType
+	)
+
+	switch e.Operator {
+	case "==":
+		value, typ = isEqual(left, lt, right, rt), ast.VarBool
+	case "!=":
+		value, typ = !isEqual(left, lt, right, rt), ast.VarBool
+	case "<", "<=", ">", ">=":
+		value, typ, err = compare(e.Operator, left, lt, right, rt)
+	default:
+		value, typ, err = arithmetic(e.Operator, left, lt, right, rt)
+	}
+
+	if err != nil {
+		return nil, ast.VarUnknown, exprErr(ErrInvalidExpression, e, err)
+	}
+
+	return value, typ, nil
+}
+
+// arithmetic applies + - * / % on numbers. Integers are promoted to
+// floats when the other operand is a float. Strings can be joined with +.
+func arithmetic(op string, left interface{}, lt ast.NodeType, right interface{}, rt ast.NodeType) (interface{}, ast.NodeType, error) {
+	if op == "+" && (isString(lt) || isString(rt)) {
+		if !isScalar(lt) || !isScalar(rt) {
+			return nil, ast.VarUnknown, fmt.Errorf("cannot add %s and %s", lt, rt)
+		}
+
+		// Joining a safe value escapes the other side, so the result stays safe
+		if lt == ast.VarSafe || rt == ast.VarSafe {
+			return safeString(left, lt) + safeString(right, rt), ast.VarSafe, nil
+		}
+		return fmt.Sprint(left) + fmt.Sprint(right), ast.VarString, nil
+	}
+
+	if lt == ast.VarNumber && rt == ast.VarNumber {
+		l, r := left.(int), right.(int)
+
+		switch op {
+		case "+":
+			return l + r, ast.VarNumber, nil
+		case "-":
+			return l - r, ast.VarNumber, nil
+		case "*":
+			return l * r, ast.VarNumber, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, ast.VarUnknown, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return l / r, ast.VarNumber, nil
+			}
+			return l % r, ast.VarNumber, nil
+		}
+	}
+
+	if isNumeric(lt) && isNumeric(rt) {
+		l, r := toFloat(left), toFloat(right)
+
+		switch op {
+		case "+":
+			return l + r, ast.VarFloat, nil
+		case "-":
+			return l - r, ast.VarFloat, nil
+		case "*":
+			return l * r, ast.VarFloat, nil
+		case "/", "%":
+			if r == 0 {
+				return nil, ast.VarUnknown, fmt.Errorf("division by zero")
+			}
+			if op == "/" {
+				return l / r, ast.VarFloat, nil
+			}
+			return math.Mod(l, r), ast.VarFloat, nil
+		}
+	}
+
+	return nil, ast.VarUnknown, fmt.Errorf("unsupported operation: %s %s %s", lt, op, rt)
+}
+
+// compare applies the ordering operators on numbers or strings
+func compare(op string, left interface{}, lt ast.NodeType, right interface{}, rt ast.NodeType) (interface{}, ast.NodeType, error) {
+	var cmp int
+
+	switch {
+	case lt == ast.VarNumber && rt == ast.VarNumber:
+		l, r := left.(int), right.(int)
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case isNumeric(lt) && isNumeric(rt):
+		l, r := toFloat(left), toFloat(right)
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	case isString(lt) && isString(rt):
+		l, r := left.(string), right.(string)
+
+		switch {
+		case l < r:
+			cmp = -1
+		case l > r:
+			cmp = 1
+		}
+	default:
+		return nil, ast.VarUnknown, fmt.Errorf("cannot compare %s and %s", lt, rt)
+	}
+
+	switch op {
+	case "<":
+		return cmp < 0, ast.VarBool, nil
+	case "<=":
+		return cmp <= 0, ast.VarBool, nil
+	case ">":
+		return cmp > 0, ast.VarBool, nil
+	}
+	return cmp >= 0, ast.VarBool, nil
+}
+
+func isEqual(left interface{}, lt ast.NodeType, right interface{}, rt ast.NodeType) bool {
+	switch {
+	case lt == ast.VarNumber && rt == ast.VarNumber:
+		return left.(int) == right.(int)
+	case isNumeric(lt) && isNumeric(rt):
+		return toFloat(left) == toFloat(right)
+	case isString(lt) && isString(rt):
+		return left.(string) == right.(string)
+	case lt != rt:
+		return false
+	}
+
+	return left == right
+}
+
+// safeString returns the value as HTML, escaping it if it is not safe
+func safeString(v interface{}, t ast.NodeType) string {
+	if t == ast.VarSafe {
+		return v.(string)
+	}
+	return html.EscapeString(fmt.Sprint(v))
+}
+
+func isString(t ast.NodeType) bool {
+	return toPkgType(t).IsString()
+}
+
+func isNumeric(t ast.NodeType) bool {
+	return t == ast.VarNumber || t == ast.VarFloat
+}
+
+func isScalar(t ast.NodeType) bool {
+	return isString(t) || isNumeric(t) || t == ast.VarBool
+}
+
+func toFloat(v interface{}) float64 {
+	switch v := v.(type) {
+	case int:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return 0
+}
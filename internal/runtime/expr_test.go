@@ -0,0 +1,63 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEvalExpression(t *testing.T) {
+	tests := map[string]string{
+		`1 + 2 * 3`:                     "7",
+		`(1 + 2) * 3`:                   "9",
+		`7 / 2`:                         "3",
+		`7 % 4`:                         "3",
+		`7 / 2.0`:                       "3.5",
+		`1.5 + 2`:                       "3.5",
+		`-2 * -3`:                       "6",
+		`2 <= 2.0`:                      "true",
+		`"a" < "b"`:                     "true",
+		`!(1 > 2) && 3 >= 3`:            "true",
+		`1 == 1.0`:                      "true",
+		`"1" == 1`:                      "false",
+		`nil == nil`:                    "true",
+		`"count: " + 3`:                 "count: 3",
+		`false && missing()`:            "false",
+		`true || missing()`:             "true",
+		`double(2) + double(3) * 2`:     "16",
+		`double(1 + 2) > 5 && true`:     "true",
+		`double(double(1.25))`:          "5",
+		`"x" + (1 + 2) + double(1) * 2`: "x34",
+	}
+
+	for expr, want := range tests {
+		src := `
+func double(n) {
+    return n * 2;
+}
+
+let result = ` + expr + `;
+out.write(result);
+`
+		if got := runSource(t, src); got != want {
+			t.Errorf("%s: want %s, got %s", expr, want, got)
+		}
+	}
+}
+
+func TestEvalExpressionErrors(t *testing.T) {
+	tests := map[string]string{
+		`1 / 0`:     "division by zero",
+		`1 + true`:  "unsupported operation",
+		`1 && true`: "expects booleans",
+		`-"a"`:      "not supported",
+		`"a" < 1`:   "cannot compare",
+		`missing`:   "invalid variable reference",
+	}
+
+	for expr, want := range tests {
+		_, err := execSource(t, "let result = "+expr+";")
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", expr, want, err)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package runtime
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// FilterFunc formats a value in a template interpolation.
+// The args are the arguments of the filter: {{ value | name(args) }}
+type FilterFunc func(value *packages.Variable, args []*packages.Variable) (*packages.Variable, error)
+
+var builtinFilters = map[string]FilterFunc{
+	"upper":     filterUpper,
+	"lower":     filterLower,
+	"title":     filterTitle,
+	"truncate":  filterTruncate,
+	"default":   filterDefault,
+	"join":      filterJoin,
+	"date":      filterDate,
+	"number":    filterNumber,
+	"json":      filterJSON,
+	"escape":    filterEscape,
+	"raw":       filterRaw,
+	"urlencode": filterURLEncode,
+}
+
+func filterUpper(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("upper", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(strings.ToUpper(formatValue(v))), nil
+}
+
+func filterLower(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("lower", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(strings.ToLower(formatValue(v))), nil
+}
+
+// filterTitle capitalizes the first letter of every word
+func filterTitle(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("title", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	runes := []rune(formatValue(v))
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return stringVar(string(runes)), nil
+}
+
+// filterTruncate shortens the value to the given number of characters
+// and appends a suffix, "..." by default
+func filterTruncate(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("truncate", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	length, ok := args[0].Value.(int)
+	if args[0].Type != packages.VarNumber || !ok || length < 0 {
+		return nil, errors.New("truncate expects a positive number")
+	}
+
+	suffix := "..."
+	if len(args) == 2 {
+		if !args[1].Type.IsString() {
+			return nil, errors.New("truncate expects a string suffix")
+		}
+		suffix = args[1].Value.(string)
+	}
+
+	s := formatValue(v)
+	if utf8.RuneCountInString(s) <= length {
+		return stringVar(s), nil
+	}
+	return stringVar(string([]rune(s)[:length]) + suffix), nil
+}
+
+// filterDefault replaces nil and empty values
+func filterDefault(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("default", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	if v.Value == nil || v.Type.IsString() && v.Value.(string) == "" {
+		return args[0], nil
+	}
+	return v, nil
+}
+
+// filterJoin joins the items of a list with a separator, ", " by default
+func filterJoin(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("join", args, 0, 1); err != nil {
+		return nil, err
+	}
+
+	list, ok := v.Value.(*packages.List)
+	if !ok {
+		return nil, fmt.Errorf("join expects a list, got %s", v.Type)
+	}
+
+	sep := ", "
+	if len(args) == 1 {
+		if !args[0].Type.IsString() {
+			return nil, errors.New("join expects a string separator")
+		}
+		sep = args[0].Value.(string)
+	}
+
+	items := make([]string, len(list.Items))
+	for i, item := range list.Items {
+		items[i] = formatValue(item)
+	}
+	return stringVar(strings.Join(items, sep)), nil
+}
+
+// filterDate formats a unix timestamp or an RFC 3339 date with a Go layout,
+// "2006-01-02" by default
+func filterDate(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("date", args, 0, 1); err != nil {
+		return nil, err
+	}
+
+	layout := time.DateOnly
+	if len(args) == 1 {
+		if !args[0].Type.IsString() {
+			return nil, errors.New("date expects a string layout")
+		}
+		layout = args[0].Value.(string)
+	}
+
+	var t time.Time
+	switch value := v.Value.(type) {
+	case int:
+		t = time.Unix(int64(value), 0).UTC()
+	case string:
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("date expects an RFC 3339 date: %w", err)
+		}
+		t = parsed
+	default:
+		return nil, fmt.Errorf("date expects a timestamp or a string, got %s", v.Type)
+	}
+
+	return stringVar(t.Format(layout)), nil
+}
+
+// filterNumber formats a number with the given decimals
+func filterNumber(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("number", args, 0, 1); err != nil {
+		return nil, err
+	}
+
+	decimals := 0
+	if len(args) == 1 {
+		d, ok := args[0].Value.(int)
+		if !ok || d < 0 {
+			return nil, errors.New("number expects a positive number of decimals")
+		}
+		decimals = d
+	}
+
+	var f float64
+	switch value := v.Value.(type) {
+	case int:
+		f = float64(value)
+	case float64:
+		f = value
+	default:
+		return nil, fmt.Errorf("number expects a number, got %s", v.Type)
+	}
+
+	return stringVar(strconv.FormatFloat(f, 'f', decimals, 64)), nil
+}
+
+func filterJSON(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("json", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(v.Value)
+	if err != nil {
+		return nil, err
+	}
+	return stringVar(string(b)), nil
+}
+
+// filterEscape escapes the value as HTML, the result is not escaped again
+func filterEscape(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("escape", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	if v.Type == packages.VarSafe {
+		return v, nil
+	}
+	return &packages.Variable{Type: packages.VarSafe, Value: html.EscapeString(formatValue(v))}, nil
+}
+
+// filterRaw marks the value as safe, it is written without escaping
+func filterRaw(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("raw", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return &packages.Variable{Type: packages.VarSafe, Value: formatValue(v)}, nil
+}
+
+func filterURLEncode(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := filterArgs("urlencode", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(url.QueryEscape(formatValue(v))), nil
+}
+
+func filterArgs(name string, args []*packages.Variable, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("%s filter expects %d arguments, %d given", name, min, len(args))
+		}
+		return fmt.Errorf("%s filter expects %d to %d arguments, %d given", name, min, max, len(args))
+	}
+	return nil
+}
+
+// formatValue returns the value as it is written to a template,
+// nil values are empty
+func formatValue(v *packages.Variable) string {
+	if v == nil || v.Value == nil {
+		return ""
+	}
+	return fmt.Sprint(v.Value)
+}
+
+func stringVar(s string) *packages.Variable {
+	return &packages.Variable{Type: packages.VarString, Value: s}
+}
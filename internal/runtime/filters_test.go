@@ -0,0 +1,103 @@
+package runtime
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+func TestTemplateFilters(t *testing.T) {
+	tests := map[string]string{
+		`{{ title | upper }}`:                              "HELLO &lt;WORLD&gt;",
+		`{{ "HeLLo" | lower }}`:                            "hello",
+		`{{ "hello big world" | title }}`:                  "Hello Big World",
+		`{{ title | truncate(5) }}`:                        "hello...",
+		`{{ title | upper | truncate(5, "…") }}`:           "HELLO…",
+		`{{ empty | default("none") }}`:                    "none",
+		`{{ nothing | default(1) }}`:                       "1",
+		`{{ tags | join }}|{{ tags | join(" / ") }}`:       "a, b|a / b",
+		`{{ 0 | date }} {{ stamp | date("Jan 2, 2006") }}`: "1970-01-01 Mar 4, 2021",
+		`{{ price | number(2) }} {{ 3 | number }}`:         "9.50 3",
+		`<script>let t = {{ tags | json }};</script>`:      `<script>let t = "[\"a\",\"b\"]";</script>`,
+		`{{ user | json }}`:                                "{&#34;name&#34;:&#34;John&#34;,&#34;age&#34;:30}",
+		`{{ title | escape }}`:                             "hello &lt;world&gt;",
+		`{{ "<b>" | raw }}`:                                "<b>",
+		`<a href="/?q={{ title | urlencode }}">`:           `<a href="/?q=hello%2B%253Cworld%253E">`,
+		`{{ true || false }}|{{ "a|b" }}`:                  "true|a|b",
+		`{{ title | shout }}`:                              "hello &lt;world&gt;!",
+		`{{ title | wrap("[", "]") | upper }}`:             "[HELLO &lt;WORLD&gt;]",
+	}
+
+	for tmpl, want := range tests {
+		out, err := execSource(t, `
+func shout(s) {
+    return s + "!";
+}
+
+func wrap(s, left, right) {
+    return left + s + right;
+}
+
+let title = "hello <world>";
+let empty = "";
+let nothing = nil;
+let tags = ["a", "b"];
+let stamp = "2021-03-04T10:00:00Z";
+let price = 9.5;
+let user = {"name": "John", "age": 30};
+out.write(<>`+tmpl+`</>);
+`)
+		if err != nil {
+			t.Errorf("%s: %v", tmpl, err)
+			continue
+		}
+
+		if out != want {
+			t.Errorf("%s:\nwant: %s\ngot:  %s", tmpl, want, out)
+		}
+	}
+}
+
+func TestTemplateFilterErrors(t *testing.T) {
+	tests := map[string]string{
+		`{{ "a" | nope }}`:           "unknown filter 'nope'",
+		`{{ "a" | truncate }}`:       "truncate filter expects 1 to 2 arguments",
+		`{{ 5 | join }}`:             "join expects a list",
+		`{{ "a" | }}`:                "empty expression",
+		`{{ "a" | 5 }}`:              "invalid filter '5'",
+		`{{ "a" | truncate(nope) }}`: "invalid variable reference",
+	}
+
+	for tmpl, want := range tests {
+		_, err := execSource(t, `let t = <>`+tmpl+`</>;`)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", tmpl, want, err)
+		}
+	}
+}
+
+func TestRuntimeFilter(t *testing.T) {
+	runt := New()
+	runt.Filter("reverse", func(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+		runes := []rune(v.Value.(string))
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return &packages.Variable{Type: packages.VarString, Value: string(runes)}, nil
+	})
+	runt.Filter("upper", func(v *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+		return nil, errors.New("overridden")
+	})
+
+	out := runWith(t, runt, `out.write(<>{{ "abc" | reverse }}</>);`)
+	if out != "cba" {
+		t.Errorf("want %q, got %q", "cba", out)
+	}
+
+	_, err := execWith(t, runt, `out.write(<>{{ "abc" | upper }}</>);`)
+	if err == nil || !strings.Contains(err.Error(), "overridden") {
+		t.Errorf("expected the registered filter to be used, got %v", err)
+	}
+}
@@ -1,12 +1,52 @@
 package runtime
 
 import (
+	"strings"
+
 	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
 )
 
 type funcDecl struct {
-	Args []ast.Node
-	Body []ast.Node
+	Name   string
+	Params []*ast.Param
+	Body   []ast.Stmt
+	// Info is the position of the declaration
+	Info ast.NodeFileInfo
+	// Component functions can be used as tags in templates
+	Component bool
+	// Env is the executer the function is declared in, the function runs
+	// in a child of it, so it sees the variables of its declaration
+	Env Executer
+}
+
+// closure is a function value. The function runs in a child executer of the
+// executer it was created in, so it sees the variables of that scope by reference.
+type closure struct {
+	decl funcDecl
+	env  Executer
+}
+
+// call calls the function, info is the position of the call
+func (f *closure) call(args []*variable, info ast.NodeFileInfo) ([]*packages.FuncReturn, error) {
+	return f.env.callDecl(f.decl, args, info)
+}
+
+// Call calls the function from a package
+func (f *closure) Call(args ...*packages.Variable) ([]*packages.FuncReturn, error) {
+	vars := make([]*variable, len(args))
+	for i, arg := range args {
+		vars[i] = &variable{Type: toNodeType(arg.Type), Value: arg.Value}
+	}
+	return f.call(vars, ast.NodeFileInfo{})
+}
+
+func (f *closure) String() string {
+	params := make([]string, len(f.decl.Params))
+	for i, param := range f.decl.Params {
+		params[i] = param.Name
+	}
+	return "func(" + strings.Join(params, ", ") + ")"
 }
 
 func getType(v any) ast.NodeType {
@@ -19,6 +59,12 @@ func getType(v any) ast.NodeType {
 		return ast.VarString
 	case bool:
 		return ast.VarBool
+	case *packages.List:
+		return ast.VarList
+	case *packages.Map:
+		return ast.VarMap
+	case packages.Func:
+		return ast.VarFunc
 	case nil:
 		return ast.VarNil
 	}
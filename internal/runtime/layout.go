@@ -0,0 +1,242 @@
+package runtime
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// templateState holds the layout and the block overrides of a rendered file
+type templateState struct {
+	// layout is the file set by extends()
+	layout string
+	// blocks are the blocks of the extending templates
+	blocks map[string]*templateBlock
+	// stack holds the files that are being rendered, to detect cycles
+	stack []string
+}
+
+// templateBlock is a block of an extending template. It is rendered where
+// the layout puts it, so its values are escaped for the layout's context,
+// in the scope of the template it is declared in.
+type templateBlock struct {
+	c     *CodeExecuter
+	ex    Executer
+	nodes []ast.TemplateNode
+}
+
+// child returns the state of a layout or a partial rendered from this state
+func (s *templateState) child(file string, blocks map[string]*templateBlock) (*templateState, error) {
+	for i, f := range s.stack {
+		if f == file {
+			chain := make([]string, 0, len(s.stack)-i+1)
+			for _, f := range append(s.stack[i:], file) {
+				chain = append(chain, filepath.Base(f))
+			}
+			return nil, fmt.Errorf("%w: %s", ErrTemplateCycle, strings.Join(chain, " -> "))
+		}
+	}
+
+	return &templateState{
+		blocks: blocks,
+		stack:  append(append([]string(nil), s.stack...), file),
+	}, nil
+}
+
+type cachedFile struct {
+	hash  string
+	nodes []ast.Stmt
+}
+
+// fileCache holds the parsed layouts and partials by their absolute path.
+// The entries are parsed again when the content of the file changes.
+var fileCache = struct {
+	sync.Mutex
+	files map[string]cachedFile
+}{files: make(map[string]cachedFile)}
+
+// parseFile returns the nodes of a file, parsing it only if it has changed
+func parseFile(file string) ([]ast.Stmt, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := md5.Sum(src)
+	hash := hex.EncodeToString(sum[:])
+
+	fileCache.Lock()
+	cached, ok := fileCache.files[file]
+	fileCache.Unlock()
+
+	if ok && cached.hash == hash {
+		return cached.nodes, nil
+	}
+
+	tokens, err := lexer.Tokenize(file, string(src))
+	if err != nil {
+		return nil, err
+	}
+
+	ps := ast.NewParser(tokens)
+	if err := ps.Parse(); err != nil {
+		return nil, err
+	}
+
+	fileCache.Lock()
+	fileCache.files[file] = cachedFile{hash: hash, nodes: ps.Nodes}
+	fileCache.Unlock()
+
+	return ps.Nodes, nil
+}
+
+// renderFile executes a layout or a partial in its own scope with the given
+// variables. The value returned by the file is the rendered content.
+func renderFile(runt *Runtime, file string, vars map[string]*variable, state *templateState) (*packages.FuncReturn, error) {
+	nodes, err := parseFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ex, execNodes, err := runt.Executer(file, false, nil, "partial", make(map[string]packages.Package), nodes)
+	if err != nil {
+		return nil, err
+	}
+	ex.setTemplateState(state)
+
+	for name, v := range vars {
+		if err := ex.DeclareVariable(name, v); err != nil {
+			return nil, fmt.Errorf("cannot declare '%s': %w", name, err)
+		}
+	}
+
+	ret, err := ex.Execute(execNodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return &packages.FuncReturn{Type: packages.VarNil}, nil
+	}
+	return ret[0], nil
+}
+
+// runFnExtends sets the layout of the templates with blocks in the file
+func runFnExtends(e Executer, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("extends function expects 1 argument, %d given", len(args))
+	}
+
+	if !args[0].Type.IsString() {
+		return nil, fmt.Errorf("extends function expects string argument, %s given", args[0].Type)
+	}
+
+	file, err := filepath.Abs(filepath.Join(e.GetDir(), args[0].Value.(string)))
+	if err != nil {
+		return nil, err
+	}
+
+	state := e.templateState()
+	if state.layout != "" && state.layout != file {
+		return nil, fmt.Errorf("extends function can only set one layout, %s is already extended", filepath.Base(state.layout))
+	}
+
+	state.layout = file
+	return nil, nil
+}
+
+// runFnInclude renders a partial. The keys of the data map are
+// the variables of the partial.
+func runFnInclude(e Executer, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, fmt.Errorf("include function expects 1 or 2 arguments, %d given", len(args))
+	}
+
+	if !args[0].Type.IsString() {
+		return nil, fmt.Errorf("include function expects string argument, %s given", args[0].Type)
+	}
+
+	vars := make(map[string]*variable)
+	if len(args) == 2 && args[1].Type != packages.VarNil {
+		data, ok := args[1].Value.(*packages.Map)
+		if !ok {
+			return nil, fmt.Errorf("include function expects map data, %s given", args[1].Type)
+		}
+
+		for _, key := range data.Keys() {
+			v, _ := data.Get(key)
+			vars[key] = &variable{Type: toNodeType(v.Type), Value: v.Value}
+		}
+	}
+
+	file, err := filepath.Abs(filepath.Join(e.GetDir(), args[0].Value.(string)))
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := e.templateState().child(file, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret, err := renderFile(e.runtime(), file, vars, state)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*packages.FuncReturn{ret}, nil
+}
+
+// renderLayout renders the blocks of the template and the layout of the file
+// with them. Blocks that are overridden by an extending template are kept.
+func (r *templateRenderer) renderLayout(ex Executer, nodes []ast.TemplateNode) (string, error) {
+	blocks := make(map[string]*templateBlock)
+	for name, block := range r.state.blocks {
+		blocks[name] = block
+	}
+
+	for _, node := range nodes {
+		if node.Kind != ast.TemplateBlock {
+			continue
+		}
+
+		if _, ok := blocks[node.Content]; ok {
+			continue
+		}
+
+		blocks[node.Content] = &templateBlock{c: r.c, ex: ex, nodes: node.Children}
+	}
+
+	state, err := r.state.child(r.state.layout, blocks)
+	if err != nil {
+		return "", infoErr(ErrInvalidTemplate, r.info, err)
+	}
+
+	ret, err := renderFile(r.c.runt, r.state.layout, nil, state)
+	if err != nil {
+		return "", infoErr(ErrInvalidTemplate, r.info, err)
+	}
+
+	if !ret.Type.IsString() {
+		return "", infoErr(ErrInvalidTemplate, r.info, fmt.Errorf("layout %s must return a template, got %s", filepath.Base(r.state.layout), ret.Type))
+	}
+
+	return ret.Value.(string), nil
+}
+
+func hasBlocks(nodes []ast.TemplateNode) bool {
+	for _, node := range nodes {
+		if node.Kind == ast.TemplateBlock {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package runtime
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLayoutBlocks(t *testing.T) {
+	out, err := execFiles(t, New(), map[string]string{
+		"main.smt": `
+extends("layouts/page.smt");
+
+let user = {"name": "<John>"};
+out.write(<>
+ignored
+{{ block title }}Profile of {{ user.name }}{{ end }}
+{{ block content }}<p>{{ include("partials/card.smt", {"title": user.name, "tags": ["a", "b"]}) }}</p>{{ end }}
+</>);
+`,
+		"layouts/page.smt": `
+extends("base.smt");
+
+return <>{{ block body }}<main>{{ block content }}no content{{ end }}</main><footer>{{ block footer }}{{ include("../partials/footer.smt") }}{{ end }}</footer>{{ end }}</>;
+`,
+		"layouts/base.smt": `
+return <><title>{{ block title }}Site{{ end }}</title><body>{{ block body }}{{ end }}</body></>;
+`,
+		"partials/footer.smt": `return "page footer";`,
+		"partials/card.smt": `
+return <><div>{{ title }}: {{ tags | join }}</div></>;
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<title>Profile of &lt;John&gt;</title><body><main><p><div>&lt;John&gt;: a, b</div></p></main><footer>page footer</footer></body>`
+	if out != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, out)
+	}
+}
+
+func TestLayoutBlockEscaping(t *testing.T) {
+	out, err := execFiles(t, New(), map[string]string{
+		"main.smt": `
+extends("layout.smt");
+
+let url = "javascript:alert(1)";
+let input = "1; alert(document.cookie);";
+let items = ["a", "b"];
+out.write(<>
+{{ block link }}{{ url }}{{ end }}
+{{ block data }}{{ input }}{{ end }}
+{{ block list }}{{ for item in items }}<li>{{ item | upper }}</li>{{ end }}{{ end }}
+</>);
+`,
+		"layout.smt": `
+return <><a href="{{ block link }}/{{ end }}">x</a><script>var n = {{ block data }}0{{ end }};</script><ul>{{ block list }}{{ end }}</ul></>;
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `<a href="#unsafe">x</a><script>var n = "1; alert(document.cookie);";</script><ul><li>A</li><li>B</li></ul>`
+	if out != want {
+		t.Errorf("\nwant: %s\ngot:  %s", want, out)
+	}
+}
+
+func TestIncludeScope(t *testing.T) {
+	out, err := execFiles(t, New(), map[string]string{
+		"main.smt": `
+let secret = "hidden";
+out.write(include("partial.smt", {"n": 1}));
+out.write(include("partial.smt", {"n": 2}));
+`,
+		"partial.smt": `
+func show(n) {
+    return <>{{ n }}</>;
+}
+return show(n + 1);
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if out != "23" {
+		t.Errorf("want %q, got %q", "23", out)
+	}
+
+	_, err = execFiles(t, New(), map[string]string{
+		"main.smt":    `let secret = "hidden"; out.write(include("partial.smt"));`,
+		"partial.smt": `return secret;`,
+	})
+	if err == nil || !strings.Contains(err.Error(), "secret") {
+		t.Errorf("expected the partial to have its own scope, got %v", err)
+	}
+}
+
+func TestTemplateCycles(t *testing.T) {
+	tests := map[string]map[string]string{
+		"include": {
+			"main.smt": `out.write(include("a.smt"));`,
+			"a.smt":    `return include("b.smt");`,
+			"b.smt":    `return include("a.smt");`,
+		},
+		"extends": {
+			"main.smt":   `extends("layout.smt"); out.write(<>{{ block a }}x{{ end }}</>);`,
+			"layout.smt": `extends("main.smt"); return <>{{ block a }}{{ end }}</>;`,
+		},
+	}
+
+	for name, files := range tests {
+		_, err := execFiles(t, New(), files)
+		if err == nil || !strings.Contains(err.Error(), "template cycle") {
+			t.Errorf("%s: expected a template cycle, got %v", name, err)
+		}
+	}
+}
+
+func TestIncludeErrors(t *testing.T) {
+	tests := map[string]string{
+		`include("missing.smt");`:             "no such file",
+		`include("main.smt", [1]);`:           "expects map data",
+		`extends(1);`:                         "expects string argument",
+		`extends("a.smt"); extends("b.smt");`: "can only set one layout",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+func TestParseFileCache(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "partial.smt")
+	write := func(src string) {
+		if err := os.WriteFile(file, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write(`return 1;`)
+	first, err := parseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cached, err := parseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if &first[0] != &cached[0] {
+		t.Error("expected the unchanged file to be cached")
+	}
+
+	write(`let a = 2; return a;`)
+	changed, err := parseFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(changed) != 2 {
+		t.Errorf("expected the changed file to be parsed again, got %d nodes", len(changed))
+	}
+}
@@ -0,0 +1,587 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// MethodFunc is a method of a type: value.name(args). The receiver is the
+// value the method is called on, the result is the value of the call.
+type MethodFunc func(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error)
+
+var numberMethods = map[string]MethodFunc{
+	"abs":      methodAbs,
+	"round":    methodRound,
+	"floor":    methodFloor,
+	"ceil":     methodCeil,
+	"toFixed":  methodToFixed,
+	"toString": methodToString,
+}
+
+// builtinMethods are the methods of the built-in types. The methods of
+// strings work on every string type, see methodType.
+var builtinMethods = map[packages.VarType]map[string]MethodFunc{
+	packages.VarString: {
+		"length":     methodLength,
+		"upper":      methodUpper,
+		"lower":      methodLower,
+		"trim":       methodTrim,
+		"split":      methodSplit,
+		"contains":   methodContains,
+		"startsWith": methodStartsWith,
+		"endsWith":   methodEndsWith,
+		"replace":    methodReplace,
+		"index":      methodIndex,
+		"repeat":     methodRepeat,
+		"toString":   methodToString,
+	},
+	packages.VarNumber: numberMethods,
+	packages.VarFloat:  numberMethods,
+	packages.VarList: {
+		"length":   methodLength,
+		"push":     methodPush,
+		"pop":      methodPop,
+		"join":     methodJoin,
+		"contains": methodContains,
+		"index":    methodIndex,
+		"reverse":  methodReverse,
+		"slice":    methodSlice,
+		"map":      methodMap,
+		"filter":   methodFilter,
+		"sort":     methodSort,
+	},
+	packages.VarMap: {
+		"length": methodLength,
+		"keys":   methodKeys,
+		"values": methodValues,
+		"has":    methodHas,
+		"get":    methodGet,
+		"delete": methodDelete,
+	},
+}
+
+// methodType returns the type the methods of a value are registered for
+func methodType(t packages.VarType) packages.VarType {
+	if t.IsString() {
+		return packages.VarString
+	}
+	return t
+}
+
+// methodName returns the name of a method declared in Smarti: func string#upper(s)
+func methodName(t ast.NodeType, name string) string {
+	return string(methodType(toPkgType(t))) + "#" + name
+}
+
+func methodLength(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("length", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	v, err := getMember(recv.Value, toNodeType(recv.Type), "length")
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func methodUpper(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("upper", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(strings.ToUpper(recv.Value.(string))), nil
+}
+
+func methodLower(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("lower", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(strings.ToLower(recv.Value.(string))), nil
+}
+
+func methodTrim(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("trim", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(strings.TrimSpace(recv.Value.(string))), nil
+}
+
+// methodSplit splits a string into a list of strings by a separator
+func methodSplit(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("split", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	sep, err := stringArg("split", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	list := packages.NewList()
+	for _, part := range strings.Split(recv.Value.(string), sep) {
+		list.Append(stringVar(part))
+	}
+	return &packages.Variable{Type: packages.VarList, Value: list}, nil
+}
+
+// methodContains reports whether a string contains a substring
+// or a list contains an item
+func methodContains(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("contains", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	i, err := indexOf("contains", recv, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return boolVar(i >= 0), nil
+}
+
+func methodStartsWith(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("startsWith", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	prefix, err := stringArg("startsWith", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return boolVar(strings.HasPrefix(recv.Value.(string), prefix)), nil
+}
+
+func methodEndsWith(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("endsWith", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	suffix, err := stringArg("endsWith", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return boolVar(strings.HasSuffix(recv.Value.(string), suffix)), nil
+}
+
+// methodReplace replaces every occurrence of a substring
+func methodReplace(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("replace", args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	old, err := stringArg("replace", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	replacement, err := stringArg("replace", args[1])
+	if err != nil {
+		return nil, err
+	}
+	return stringVar(strings.ReplaceAll(recv.Value.(string), old, replacement)), nil
+}
+
+// methodIndex returns the index of a substring or an item, -1 if it is missing
+func methodIndex(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("index", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	i, err := indexOf("index", recv, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return numberVar(i), nil
+}
+
+func methodRepeat(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("repeat", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	n, ok := args[0].Value.(int)
+	if args[0].Type != packages.VarNumber || !ok || n < 0 {
+		return nil, errors.New("repeat expects a positive number")
+	}
+	return stringVar(strings.Repeat(recv.Value.(string), n)), nil
+}
+
+// methodToString formats the value like it is written by io.write
+func methodToString(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("toString", args, 0, 0); err != nil {
+		return nil, err
+	}
+	return stringVar(formatValue(recv)), nil
+}
+
+func methodAbs(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("abs", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	if n, ok := recv.Value.(int); ok {
+		if n < 0 {
+			n = -n
+		}
+		return numberVar(n), nil
+	}
+	return floatVar(math.Abs(toFloat(recv.Value))), nil
+}
+
+// methodRound, methodFloor and methodCeil return numbers, integers are not changed
+func methodRound(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	return roundWith("round", math.Round, recv, args)
+}
+
+func methodFloor(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	return roundWith("floor", math.Floor, recv, args)
+}
+
+func methodCeil(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	return roundWith("ceil", math.Ceil, recv, args)
+}
+
+func roundWith(name string, round func(float64) float64, recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs(name, args, 0, 0); err != nil {
+		return nil, err
+	}
+	return numberVar(int(round(toFloat(recv.Value)))), nil
+}
+
+// methodToFixed formats a number with the given decimals
+func methodToFixed(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("toFixed", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	decimals, ok := args[0].Value.(int)
+	if args[0].Type != packages.VarNumber || !ok || decimals < 0 {
+		return nil, errors.New("toFixed expects a positive number of decimals")
+	}
+	return stringVar(strconv.FormatFloat(toFloat(recv.Value), 'f', decimals, 64)), nil
+}
+
+// methodPush appends the items to the list and returns the list
+func methodPush(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	recv.Value.(*packages.List).Append(args...)
+	return recv, nil
+}
+
+// methodPop removes the last item of the list and returns it
+func methodPop(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("pop", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	list := recv.Value.(*packages.List)
+	if list.Len() == 0 {
+		return nil, errors.New("pop of an empty list")
+	}
+
+	last := list.Items[list.Len()-1]
+	list.Items = list.Items[:list.Len()-1]
+	return last, nil
+}
+
+// methodJoin joins the items of the list with a separator, ", " by default
+func methodJoin(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("join", args, 0, 1); err != nil {
+		return nil, err
+	}
+	return filterJoin(recv, args)
+}
+
+// methodReverse returns a new list with the items in reverse order
+func methodReverse(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("reverse", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	items := recv.Value.(*packages.List).Items
+	reversed := packages.NewList()
+	for i := len(items) - 1; i >= 0; i-- {
+		reversed.Append(items[i])
+	}
+	return &packages.Variable{Type: packages.VarList, Value: reversed}, nil
+}
+
+// methodSlice returns a new list of the items from start until end,
+// the end is the length of the list by default
+func methodSlice(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("slice", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	items := recv.Value.(*packages.List).Items
+	bounds := []int{0, len(items)}
+	for i, arg := range args {
+		n, ok := arg.Value.(int)
+		if arg.Type != packages.VarNumber || !ok {
+			return nil, fmt.Errorf("slice expects numbers, got %s", arg.Type)
+		}
+		bounds[i] = n
+	}
+
+	start, end := bounds[0], bounds[1]
+	if start < 0 || end > len(items) || start > end {
+		return nil, fmt.Errorf("slice bounds [%d:%d] out of range [0:%d]", start, end, len(items))
+	}
+	return &packages.Variable{Type: packages.VarList, Value: packages.NewList(append([]*packages.Variable(nil), items[start:end]...)...)}, nil
+}
+
+// methodMap returns a new list of the results of the function called with each item
+func methodMap(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	fn, err := funcArg("map", args)
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := packages.NewList()
+	for _, item := range recv.Value.(*packages.List).Items {
+		v, err := callMethodFunc(fn, item)
+		if err != nil {
+			return nil, err
+		}
+		mapped.Append(v)
+	}
+	return &packages.Variable{Type: packages.VarList, Value: mapped}, nil
+}
+
+// methodFilter returns a new list of the items the function returns true for
+func methodFilter(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	fn, err := funcArg("filter", args)
+	if err != nil {
+		return nil, err
+	}
+
+	filtered := packages.NewList()
+	for _, item := range recv.Value.(*packages.List).Items {
+		v, err := callMethodFunc(fn, item)
+		if err != nil {
+			return nil, err
+		}
+
+		keep, ok := v.Value.(bool)
+		if v.Type != packages.VarBool || !ok {
+			return nil, fmt.Errorf("filter function must return a boolean, got %s", v.Type)
+		}
+
+		if keep {
+			filtered.Append(item)
+		}
+	}
+	return &packages.Variable{Type: packages.VarList, Value: filtered}, nil
+}
+
+// methodSort sorts the list in place and returns it. Numbers and strings are
+// sorted in ascending order, a less(a, b) function can sort any other order.
+func methodSort(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("sort", args, 0, 1); err != nil {
+		return nil, err
+	}
+
+	var fn packages.Func
+	if len(args) == 1 {
+		var err error
+		if fn, err = funcArg("sort", args); err != nil {
+			return nil, err
+		}
+	}
+
+	var sortErr error
+	less := func(a, b *packages.Variable) bool {
+		if fn == nil {
+			v, _, err := compare("<", a.Value, toNodeType(a.Type), b.Value, toNodeType(b.Type))
+			if err != nil {
+				sortErr = err
+				return false
+			}
+			return v.(bool)
+		}
+
+		v, err := callMethodFunc(fn, a, b)
+		if err != nil {
+			sortErr = err
+			return false
+		}
+
+		before, ok := v.Value.(bool)
+		if v.Type != packages.VarBool || !ok {
+			sortErr = fmt.Errorf("sort function must return a boolean, got %s", v.Type)
+		}
+		return before
+	}
+
+	items := recv.Value.(*packages.List).Items
+	sort.SliceStable(items, func(i, j int) bool {
+		return sortErr == nil && less(items[i], items[j])
+	})
+
+	if sortErr != nil {
+		return nil, sortErr
+	}
+	return recv, nil
+}
+
+// methodKeys returns the keys of the map in insertion order
+func methodKeys(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("keys", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	keys := packages.NewList()
+	for _, key := range recv.Value.(*packages.Map).Keys() {
+		keys.Append(stringVar(key))
+	}
+	return &packages.Variable{Type: packages.VarList, Value: keys}, nil
+}
+
+// methodValues returns the values of the map in insertion order
+func methodValues(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("values", args, 0, 0); err != nil {
+		return nil, err
+	}
+
+	m := recv.Value.(*packages.Map)
+	values := packages.NewList()
+	for _, key := range m.Keys() {
+		v, _ := m.Get(key)
+		values.Append(v)
+	}
+	return &packages.Variable{Type: packages.VarList, Value: values}, nil
+}
+
+func methodHas(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("has", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	key, err := stringArg("has", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	_, ok := recv.Value.(*packages.Map).Get(key)
+	return boolVar(ok), nil
+}
+
+// methodGet returns the value of a key, or the default value if the key is missing
+func methodGet(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("get", args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	key, err := stringArg("get", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	if v, ok := recv.Value.(*packages.Map).Get(key); ok {
+		return v, nil
+	}
+
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	return &packages.Variable{Type: packages.VarNil}, nil
+}
+
+// methodDelete removes a key of the map and returns the map
+func methodDelete(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+	if err := methodArgs("delete", args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	key, err := stringArg("delete", args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	recv.Value.(*packages.Map).Delete(key)
+	return recv, nil
+}
+
+// indexOf returns the index of a substring in a string or an item in a list
+func indexOf(name string, recv, v *packages.Variable) (int, error) {
+	if recv.Type.IsString() {
+		sub, err := stringArg(name, v)
+		if err != nil {
+			return 0, err
+		}
+
+		s := recv.Value.(string)
+		i := strings.Index(s, sub)
+		if i < 0 {
+			return -1, nil
+		}
+		return utf8.RuneCountInString(s[:i]), nil
+	}
+
+	for i, item := range recv.Value.(*packages.List).Items {
+		if isEqual(item.Value, toNodeType(item.Type), v.Value, toNodeType(v.Type)) {
+			return i, nil
+		}
+	}
+	return -1, nil
+}
+
+// callMethodFunc calls a function argument of a method and returns its result
+func callMethodFunc(fn packages.Func, args ...*packages.Variable) (*packages.Variable, error) {
+	ret, err := fn.Call(args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ret) == 0 {
+		return &packages.Variable{Type: packages.VarNil}, nil
+	}
+	return &packages.Variable{Type: ret[0].Type, Value: ret[0].Value}, nil
+}
+
+func funcArg(name string, args []*packages.Variable) (packages.Func, error) {
+	if err := methodArgs(name, args, 1, 1); err != nil {
+		return nil, err
+	}
+
+	fn, ok := args[0].Value.(packages.Func)
+	if args[0].Type != packages.VarFunc || !ok {
+		return nil, fmt.Errorf("%s expects a function, got %s", name, args[0].Type)
+	}
+	return fn, nil
+}
+
+func stringArg(name string, arg *packages.Variable) (string, error) {
+	if !arg.Type.IsString() {
+		return "", fmt.Errorf("%s expects a string, got %s", name, arg.Type)
+	}
+	return arg.Value.(string), nil
+}
+
+func methodArgs(name string, args []*packages.Variable, min, max int) error {
+	if len(args) < min || len(args) > max {
+		if min == max {
+			return fmt.Errorf("%s method expects %d arguments, %d given", name, min, len(args))
+		}
+		return fmt.Errorf("%s method expects %d to %d arguments, %d given", name, min, max, len(args))
+	}
+	return nil
+}
+
+func numberVar(n int) *packages.Variable {
+	return &packages.Variable{Type: packages.VarNumber, Value: n}
+}
+
+func floatVar(f float64) *packages.Variable {
+	return &packages.Variable{Type: packages.VarFloat, Value: f}
+}
+
+func boolVar(b bool) *packages.Variable {
+	return &packages.Variable{Type: packages.VarBool, Value: b}
+}
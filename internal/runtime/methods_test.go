@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+func TestBuiltinMethods(t *testing.T) {
+	tests := map[string]string{
+		`"  Hello ".trim().upper()`:                                                           "HELLO",
+		`"a,b,c".split(",").reverse().join("-")`:                                              "c-b-a",
+		`'héllo'.index("l") + "hello".length()`:                                               "7",
+		`"hello".contains("ell") && "hello".startsWith("h")`:                                  "true",
+		`"a.b".replace(".", "/").repeat(2)`:                                                   "a/ba/b",
+		`(0 - 2.5).abs().toFixed(2) + (7).toString()`:                                         "2.507",
+		`[1.4.round(), 1.4.ceil(), 1.6.floor()]`:                                              "[1, 2, 1]",
+		`[3, 1, 2].sort()`:                                                                    `[1, 2, 3]`,
+		`[3, 1, 2].sort(func(a, b) { return a > b; })`:                                        `[3, 2, 1]`,
+		`[1, 2, 3, 4].filter(func(x) { return x % 2 == 0; }).map(func(x) { return x * 10; })`: "[20, 40]",
+		`[1, 2, 3].slice(1).contains(1)`:                                                      "false",
+		`{"a": 1, "b": 2}.keys().join()`:                                                      "a, b",
+		`{"a": 1}.get("b", 5) + {"a": 1}.values()[0]`:                                         "6",
+		`{"a": 1}.delete("a").has("a")`:                                                       "false",
+	}
+
+	for expr, want := range tests {
+		out, err := execSource(t, "out.write("+expr+");")
+		if err != nil {
+			t.Errorf("%s: %v", expr, err)
+			continue
+		}
+
+		if out != want {
+			t.Errorf("%s: expected %q, got %q", expr, want, out)
+		}
+	}
+}
+
+func TestMethodsReturnValues(t *testing.T) {
+	expectOutput(t, `
+func string#shout(s) {
+    return s.upper() + "!";
+}
+
+func list#sum(l) {
+    let total = 0;
+    for item in l {
+        total = total + item;
+    }
+    return total;
+}
+
+let x = "hello";
+let l = x.length();
+let items = [1, 2];
+items.push(3);
+
+out.write(x, ";", l, ";", x.shout(), ";", 'hi'.shout(), ";", items.sum(), ";", items.pop(), items);
+`, "hello;5;HELLO!;HI!;6;3[1, 2]")
+}
+
+func TestSliceCopiesItems(t *testing.T) {
+	expectOutput(t, `
+let a = [1, 2, 3];
+let b = a.slice(0, 2);
+b[0] = 99;
+
+let c = [3, 1, 2];
+c.slice(0).sort();
+
+out.write(a, b, c);
+`, "[1, 2, 3][99, 2][3, 1, 2]")
+}
+
+func TestRegisteredMethods(t *testing.T) {
+	runt := New()
+	runt.Method(packages.VarString, "reverse", func(recv *packages.Variable, args []*packages.Variable) (*packages.Variable, error) {
+		runes := []rune(recv.Value.(string))
+		for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+			runes[i], runes[j] = runes[j], runes[i]
+		}
+		return stringVar(string(runes)), nil
+	})
+
+	// Smarti methods take precedence over the registered ones
+	if out := runWith(t, runt, `
+out.write("abc".reverse(), ";");
+
+func string#upper(s) {
+    return "custom";
+}
+out.write("abc".upper());
+`); out != "cba;custom" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	tests := map[string]string{
+		`out.write((1).missing());`:                     "number value does not have a method 'missing'",
+		`out.write("a".upper(1));`:                      "upper method expects 0 arguments, 1 given",
+		`out.write([1].map(1));`:                        "map expects a function, got number",
+		`out.write([1].filter(func(x) { return 1; }));`: "filter function must return a boolean, got number",
+		`out.write([1, "a"].sort());`:                   "cannot compare string and number",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", src, want, err)
+		}
+	}
+}
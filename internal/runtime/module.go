@@ -0,0 +1,176 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// module is a Smarti file imported with use "path" as name.
+// Only its exported functions and constants can be accessed.
+type module struct {
+	file    string
+	ex      Executer
+	exports map[string]ast.Decl
+}
+
+// Run calls an exported function of the module from a package
+func (m *module) Run(fn string, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	vars := make([]*variable, len(args))
+	for i, arg := range args {
+		vars[i] = &variable{Type: toNodeType(arg.Type), Value: arg.Value}
+	}
+	return m.call(fn, vars, ast.NodeFileInfo{})
+}
+
+// Access returns an exported constant or an exported function as a value
+func (m *module) Access(name string) (*packages.Variable, error) {
+	switch m.exports[name].(type) {
+	case *ast.VarDecl:
+		v, err := m.ex.GetVariable(name)
+		if err != nil {
+			return nil, err
+		}
+		return &packages.Variable{Type: toPkgType(v.Type), Value: v.Value}, nil
+	case *ast.FuncDecl:
+		fn, ok := m.ex.lookupFunc(name)
+		if !ok {
+			return nil, fmt.Errorf("function %s is not declared in %s", name, filepath.Base(m.file))
+		}
+		return &packages.Variable{Type: packages.VarFunc, Value: &closure{decl: fn, env: m.ex}}, nil
+	}
+
+	return nil, m.notExported(name)
+}
+
+// call calls an exported function of the module, info is the position of the call
+func (m *module) call(name string, args []*variable, info ast.NodeFileInfo) ([]*packages.FuncReturn, error) {
+	if _, ok := m.exports[name].(*ast.FuncDecl); !ok {
+		if _, ok := m.exports[name]; ok {
+			return nil, fmt.Errorf("%s of %s is not a function", name, filepath.Base(m.file))
+		}
+		return nil, m.notExported(name)
+	}
+
+	fn, ok := m.ex.lookupFunc(name)
+	if !ok {
+		return nil, fmt.Errorf("function %s is not declared in %s", name, filepath.Base(m.file))
+	}
+	return m.ex.callDecl(fn, args, info)
+}
+
+func (m *module) notExported(name string) error {
+	return fmt.Errorf("%s is not exported by %s", name, filepath.Base(m.file))
+}
+
+// useModule imports the module of a use statement into the executer.
+// The path of the module is relative to the current file.
+func (c *CodeExecuter) useModule(node *ast.UseStmt) error {
+	file, err := filepath.Abs(filepath.Join(c.GetDir(), node.Path))
+	if err != nil {
+		return nodeErr(ErrModule, node, err)
+	}
+
+	current, err := filepath.Abs(c.file)
+	if err != nil {
+		return nodeErr(ErrModule, node, err)
+	}
+
+	chain := append(append([]string{}, c.imports...), current)
+	for i, imported := range chain {
+		if imported == file {
+			return nodeErr(ErrImportCycle, node, fmt.Errorf("import cycle: %s", cyclePath(append(chain[i:], file))))
+		}
+	}
+
+	m, err := c.runt.loadModule(file, chain)
+	if err != nil {
+		// The syntax errors of the module are reported at their position
+		var (
+			diags  ast.Diagnostics
+			lexErr *lexer.Error
+		)
+		if errors.As(err, &diags) || errors.As(err, &lexErr) {
+			return err
+		}
+		return nodeErr(ErrModule, node, err)
+	}
+
+	c.mu.Lock()
+	c.uses[node.Alias] = m
+	c.mu.Unlock()
+	return nil
+}
+
+// cyclePath returns the files of an import cycle relative to the first one
+func cyclePath(files []string) string {
+	dir := filepath.Dir(files[0])
+
+	names := make([]string, len(files))
+	for i, file := range files {
+		name, err := filepath.Rel(dir, file)
+		if err != nil {
+			name = file
+		}
+		names[i] = name
+	}
+	return strings.Join(names, " -> ")
+}
+
+// loadModule runs a module once per runtime. Modules are cached by their
+// path and the hash of their content, a changed file is loaded again.
+// The chain holds the files that import the module, for cycle detection.
+func (r *Runtime) loadModule(file string, chain []string) (*module, error) {
+	lx := lexer.New(file)
+	if err := lx.Parse(); err != nil {
+		return nil, err
+	}
+
+	key := file + "@" + lx.Sum()
+
+	r.mu.Lock()
+	m, ok := r.modules[key]
+	r.mu.Unlock()
+	if ok {
+		return m, nil
+	}
+
+	ps := ast.NewParser(lx.Tokens)
+	if err := ps.Parse(); err != nil {
+		return nil, err
+	}
+
+	ex, nodes, err := r.Executer(file, false, nil, "module", make(map[string]packages.Package), ps.Nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	ex.setImports(chain)
+	if _, err := ex.Execute(nodes); err != nil {
+		return nil, err
+	}
+
+	m = &module{file: file, ex: ex, exports: make(map[string]ast.Decl)}
+	for _, node := range nodes {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			if node.Export {
+				m.exports[node.Name] = node
+			}
+		case *ast.VarDecl:
+			if node.Export {
+				m.exports[node.Name] = node
+			}
+		}
+	}
+
+	r.mu.Lock()
+	r.modules[key] = m
+	r.mu.Unlock()
+	return m, nil
+}
@@ -0,0 +1,113 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestModules(t *testing.T) {
+	out, err := execFiles(t, New(), map[string]string{
+		"main.smt": `
+use "./lib/users.smt" as users;
+use "lib/greet.smt";
+
+out.write(users.find(2), ";", users.limit, ";", greet.hello(users.find(1)), ";");
+
+let find = users.find;
+out.write(find(3));
+`,
+		"lib/users.smt": `
+use out;
+out.write("loaded;");
+
+export const limit = 10;
+
+let names = ["John", "Jane"];
+
+export func find(id) {
+    if id > names.length {
+        return nil;
+    }
+    return names[id - 1];
+}
+`,
+		"lib/greet.smt": `
+use "./users.smt" as users;
+
+export func hello(name) {
+    return "Hello, " + name + " of " + users.limit;
+}
+`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The module is loaded once, even if it is used by two files
+	if want := "loaded;Jane;10;Hello, John of 10;<nil>"; out != want {
+		t.Errorf("unexpected output\nwant: %q\ngot:  %q", want, out)
+	}
+}
+
+func TestModuleErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "not exported function",
+			files: map[string]string{
+				"main.smt":  `use "users.smt"; users.secret();`,
+				"users.smt": `func secret() { return 1; }`,
+			},
+			want: "secret is not exported by users.smt",
+		},
+		{
+			name: "not exported variable",
+			files: map[string]string{
+				"main.smt":  `use "users.smt"; out.write(users.names);`,
+				"users.smt": `let names = [];`,
+			},
+			want: "names is not exported by users.smt",
+		},
+		{
+			name: "missing module",
+			files: map[string]string{
+				"main.smt": `use "missing.smt";`,
+			},
+			want: "module error",
+		},
+		{
+			name: "syntax error",
+			files: map[string]string{
+				"main.smt":  `use "users.smt";`,
+				"users.smt": `export let names = [];`,
+			},
+			want: "users.smt:1:8",
+		},
+		{
+			name: "cycle",
+			files: map[string]string{
+				"main.smt":  `use "a.smt";`,
+				"a.smt":     `use "lib/b.smt";`,
+				"lib/b.smt": `use "../a.smt";`,
+			},
+			want: "import cycle: a.smt -> lib/b.smt -> a.smt",
+		},
+		{
+			name: "self import",
+			files: map[string]string{
+				"main.smt": `use "main.smt" as self;`,
+			},
+			want: "import cycle: main.smt -> main.smt",
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := execFiles(t, New(), tt.files)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: expected %q, got %v", tt.name, tt.want, err)
+		}
+	}
+}
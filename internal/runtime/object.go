@@ -0,0 +1,97 @@
+package runtime
+
+import (
+	"fmt"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// typeDecl is an object type declared with type User { name, email }
+type typeDecl struct {
+	Name   string
+	Fields []string
+}
+
+// object is a value of a declared type. The type of the value is the name
+// of the declared type, so its methods are declared like func User#greet(u).
+// Objects are shared by reference like lists and maps.
+type object struct {
+	decl   *typeDecl
+	fields *packages.Map
+}
+
+// newObject creates an object from the values of its fields in the order
+// of the declaration. The missing fields are nil.
+func newObject(decl *typeDecl, args []*variable) (*object, error) {
+	if len(args) > len(decl.Fields) {
+		return nil, fmt.Errorf("%s has %d fields, got %d values", decl.Name, len(decl.Fields), len(args))
+	}
+
+	obj := &object{decl: decl, fields: packages.NewMap()}
+	for i, field := range decl.Fields {
+		v := &packages.Variable{Type: packages.VarNil}
+		if i < len(args) {
+			v = &packages.Variable{Type: toPkgType(args[i].Type), Value: args[i].Value}
+		}
+		obj.fields.Set(field, v)
+	}
+
+	return obj, nil
+}
+
+func (o *object) get(name string) (*packages.Variable, error) {
+	v, ok := o.fields.Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%s does not have a field '%s'", o.decl.Name, name)
+	}
+	return v, nil
+}
+
+func (o *object) set(name string, v *packages.Variable) error {
+	if _, ok := o.fields.Get(name); !ok {
+		return fmt.Errorf("%s does not have a field '%s'", o.decl.Name, name)
+	}
+
+	o.fields.Set(name, v)
+	return nil
+}
+
+func (o *object) String() string {
+	return o.decl.Name + o.fields.String()
+}
+
+// MarshalJSON encodes the object as a JSON object of its fields
+func (o *object) MarshalJSON() ([]byte, error) {
+	return o.fields.MarshalJSON()
+}
+
+// construct creates an object of the type with the arguments of the call
+func construct(decl *typeDecl, args []*variable) ([]*packages.FuncReturn, error) {
+	obj, err := newObject(decl, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*packages.FuncReturn{{Type: packages.VarType(decl.Name), Value: obj}}, nil
+}
+
+// toPkgArgs returns the arguments of a package function.
+// Objects are passed to packages as the maps of their fields.
+func toPkgArgs(v []*variable) []*packages.Variable {
+	vars := toPkgVar(v)
+	for _, vv := range vars {
+		if obj, ok := vv.Value.(*object); ok {
+			vv.Type, vv.Value = packages.VarMap, obj.fields
+		}
+	}
+	return vars
+}
+
+func typeFromDecl(node *ast.TypeDecl) *typeDecl {
+	fields := make([]string, len(node.Fields))
+	for i, field := range node.Fields {
+		fields[i] = field.Name
+	}
+	return &typeDecl{Name: node.Name, Fields: fields}
+}
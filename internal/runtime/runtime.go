@@ -10,14 +10,21 @@ import (
 )
 
 type Runtime struct {
-	with map[string]packages.Package
+	with    map[string]packages.Package
+	filters map[string]FilterFunc
+	methods map[packages.VarType]map[string]MethodFunc
+	// modules are the loaded modules by their path and content hash
+	modules map[string]*module
 
 	mu sync.Mutex
 }
 
 func New() *Runtime {
 	return &Runtime{
-		with: make(map[string]packages.Package),
+		with:    make(map[string]packages.Package),
+		filters: make(map[string]FilterFunc),
+		methods: make(map[packages.VarType]map[string]MethodFunc),
+		modules: make(map[string]*module),
 	}
 }
 
@@ -27,14 +34,63 @@ func (r *Runtime) With(pkgName string, pkg packages.Package) {
 	r.mu.Unlock()
 }
 
+// Filter registers a template filter: {{ value | name(args) }}.
+// Registered filters take precedence over the built-in ones.
+func (r *Runtime) Filter(name string, fn FilterFunc) {
+	r.mu.Lock()
+	r.filters[name] = fn
+	r.mu.Unlock()
+}
+
+func (r *Runtime) filter(name string) (FilterFunc, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fn, ok := r.filters[name]; ok {
+		return fn, true
+	}
+
+	fn, ok := builtinFilters[name]
+	return fn, ok
+}
+
+// Method registers a method of a type: value.name(args). Registered methods
+// take precedence over the built-in ones, methods declared in Smarti take
+// precedence over both.
+func (r *Runtime) Method(typ packages.VarType, name string, fn MethodFunc) {
+	typ = methodType(typ)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.methods[typ] == nil {
+		r.methods[typ] = make(map[string]MethodFunc)
+	}
+	r.methods[typ][name] = fn
+}
+
+func (r *Runtime) method(typ packages.VarType, name string) (MethodFunc, bool) {
+	typ = methodType(typ)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if fn, ok := r.methods[typ][name]; ok {
+		return fn, true
+	}
+
+	fn, ok := builtinMethods[typ][name]
+	return fn, ok
+}
+
 // Run executes the given nodes as a main program
-func (r *Runtime) Run(file string, nodes []ast.Node) error {
+func (r *Runtime) Run(file string, nodes []ast.Stmt) error {
 	_, err := r.Execute(file, false, nil, "global", r.with, nodes)
 	return err
 }
 
 // Execute executes the given nodes and returns the result if any
-func (r *Runtime) Execute(file string, snippet bool, parent Executer, scope string, pkgs map[string]packages.Package, nodes []ast.Node) ([]*packages.FuncReturn, error) {
+func (r *Runtime) Execute(file string, snippet bool, parent Executer, scope string, pkgs map[string]packages.Package, nodes []ast.Stmt) ([]*packages.FuncReturn, error) {
 	ex, execNodes, err := r.Executer(file, snippet, parent, scope, pkgs, nodes)
 	if err != nil {
 		return nil, err
@@ -42,7 +98,7 @@ func (r *Runtime) Execute(file string, snippet bool, parent Executer, scope stri
 	return ex.Execute(execNodes)
 }
 
-func (r *Runtime) Executer(file string, snippet bool, parent Executer, scope string, pkgs map[string]packages.Package, nodes []ast.Node) (Executer, []ast.Node, error) {
+func (r *Runtime) Executer(file string, snippet bool, parent Executer, scope string, pkgs map[string]packages.Package, nodes []ast.Stmt) (Executer, []ast.Stmt, error) {
 	if snippet {
 		ex := NewExecuter(r, parent, file, parent.GetNamespace(), scope, parent.GetPackages())
 		return ex, nodes, nil
@@ -50,28 +106,34 @@ func (r *Runtime) Executer(file string, snippet bool, parent Executer, scope str
 
 	var (
 		namespace = ""
-		execNodes []ast.Node
+		execNodes []ast.Stmt
 	)
 
 	for _, node := range nodes {
-		switch node.Type {
-		case ast.Namespace:
+		switch node := node.(type) {
+		case *ast.NamespaceStmt:
 			if namespace != "" {
 				return nil, nil, fmt.Errorf("namespace already defined")
 			}
 			namespace = node.Name
-		case ast.UsePackage:
-			if _, ok := pkgs[node.Name]; !ok {
-				if _, ok := r.with[node.Name]; ok {
-					pkgs[node.Value] = r.with[node.Name]
+		case *ast.UseStmt:
+			if node.Path != "" {
+				// Modules are executed in order, like the rest of the file
+				execNodes = append(execNodes, node)
+				continue
+			}
+
+			if _, ok := pkgs[node.Package]; !ok {
+				if _, ok := r.with[node.Package]; ok {
+					pkgs[node.Alias] = r.with[node.Package]
 					continue
 				}
 
-				pkg := NewPackage(node.Name)
+				pkg := NewPackage(node.Package)
 				if pkg == nil {
-					return nil, nil, nodeErr(ErrPackageNotExists, node, fmt.Errorf("package '%s' not exists but used", node.Name))
+					return nil, nil, nodeErr(ErrPackageNotExists, node, fmt.Errorf("package '%s' not exists but used", node.Package))
 				}
-				pkgs[node.Value] = pkg
+				pkgs[node.Alias] = pkg
 			}
 		default:
 			execNodes = append(execNodes, node)
@@ -0,0 +1,58 @@
+package runtime
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// streamBufferSize is the size of the chunks a streamed template is written in
+const streamBufferSize = 4096
+
+// streamTarget returns the writer and the template of a call like
+// response.write(<>...</>), where the package can stream the template.
+func (c *CodeExecuter) streamTarget(name string, args []ast.Expr) (io.Writer, *ast.LiteralExpr, bool) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) != 2 || len(args) != 1 {
+		return nil, nil, false
+	}
+
+	lit, ok := args[0].(*ast.LiteralExpr)
+	if !ok || lit.Type != ast.VarTemplate {
+		return nil, nil, false
+	}
+
+	// Variables shadow the packages
+	c.mu.Lock()
+	_, ok = c.variables[parts[0]]
+	c.mu.Unlock()
+	if ok {
+		return nil, nil, false
+	}
+
+	sw, ok := c.uses[parts[0]].(packages.StreamWriter)
+	if !ok {
+		return nil, nil, false
+	}
+
+	w, ok := sw.Stream(parts[1])
+	return w, lit, ok
+}
+
+// streamTemplate renders the template into the writer in chunks. The last
+// chunk is not written if the template fails, so a template that fails before
+// its first chunk is written does not write anything.
+func (c *CodeExecuter) streamTemplate(lit *ast.LiteralExpr, w io.Writer) error {
+	bw := bufio.NewWriterSize(w, streamBufferSize)
+	if err := c.renderTemplate(lit, bw); err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return exprErr(ErrInvalidTemplate, lit, err)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package runtime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+// streamPkg streams the templates of stream.write and records the writes
+type streamPkg struct {
+	buf    *bytes.Buffer
+	writes *int
+}
+
+func (s streamPkg) Run(fn string, args []*packages.Variable) ([]*packages.FuncReturn, error) {
+	s.buf.WriteString("[run]")
+	return nil, nil
+}
+
+func (streamPkg) Access(variable string) (*packages.Variable, error) {
+	return nil, errors.New("stream package does not have any variables")
+}
+
+func (s streamPkg) Stream(fn string) (io.Writer, bool) {
+	return s, fn == "write"
+}
+
+func (s streamPkg) Write(b []byte) (int, error) {
+	*s.writes++
+	return s.buf.Write(b)
+}
+
+func streamSource(t *testing.T, src string) (string, int, error) {
+	t.Helper()
+
+	var (
+		buf    bytes.Buffer
+		writes int
+	)
+
+	runt := New()
+	runt.With("stream", streamPkg{buf: &buf, writes: &writes})
+
+	_, err := execWith(t, runt, "use stream;\n"+src)
+	return buf.String(), writes, err
+}
+
+func TestStreamTemplate(t *testing.T) {
+	out, writes, err := streamSource(t, `
+let items = ["<a>", "b"];
+stream.write(<><ul>{{ for item in items }}<li>{{ item }}</li>{{ end }}</ul></>);
+stream.write("text");
+stream.print(<>x</>);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "<ul><li>&lt;a&gt;</li><li>b</li></ul>[run][run]"; out != want {
+		t.Errorf("want %q, got %q", want, out)
+	}
+
+	if writes != 1 {
+		t.Errorf("expected the template to be written in one chunk, got %d writes", writes)
+	}
+}
+
+func TestStreamTemplateChunks(t *testing.T) {
+	out, writes, err := streamSource(t, `
+let l = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9];
+stream.write(<>{{ for a in l }}{{ for b in l }}{{ for c in l }}<li>{{ a }}{{ b }}{{ c }}</li>{{ end }}{{ end }}{{ end }}</>);
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(out) != 12000 || writes != 3 {
+		t.Errorf("expected 12000 bytes in 3 chunks, got %d bytes in %d writes", len(out), writes)
+	}
+}
+
+func TestStreamTemplateErrors(t *testing.T) {
+	// A template that fails before its first chunk is not written
+	out, _, err := streamSource(t, `stream.write(<><p>{{ missing }}</p></>);`)
+	if err == nil || out != "" {
+		t.Errorf("expected an error without output, got %q, %v", out, err)
+	}
+
+	// The chunks before the error are already written
+	out, _, err = streamSource(t, `
+let l = [0, 1, 2, 3, 4, 5, 6, 7, 8, 9];
+stream.write(<>{{ for a in l }}{{ for b in l }}{{ for c in l }}<li>{{ a }}{{ b }}{{ c }}</li>{{ end }}{{ end }}{{ end }}{{ missing }}</>);
+`)
+	if err == nil || len(out) != 2*streamBufferSize {
+		t.Errorf("expected an error after 2 chunks, got %d bytes, %v", len(out), err)
+	}
+
+	// Variables shadow the package
+	out, _, err = streamSource(t, `let stream = "x"; stream.write(<>a</>);`)
+	if err == nil || strings.Contains(out, "a") {
+		t.Errorf("expected the variable to be used, got %q, %v", out, err)
+	}
+}
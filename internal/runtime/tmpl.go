@@ -1,47 +1,187 @@
 package runtime
 
 import (
-	"regexp"
+	"fmt"
+	"io"
 	"strings"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
 )
 
-type TemplatePart struct {
-	Static  bool
-	Content string
+// templateRenderer executes a compiled template tree. The blocks are
+// executed in the scope of the executer that evaluates the template.
+type templateRenderer struct {
+	c     *CodeExecuter
+	info  ast.NodeFileInfo
+	state *templateState
+
+	out     io.Writer
+	escaper htmlEscaper
 }
 
-func parseTemplate(s string) []TemplatePart {
-	var result []TemplatePart
-	re := regexp.MustCompile(`\{\{(.*?)}}`)
-	matches := re.FindAllStringSubmatchIndex(s, -1)
+func (r *templateRenderer) render(ex Executer, nodes []ast.TemplateNode) error {
+	for _, node := range nodes {
+		switch node.Kind {
+		case ast.TemplateText:
+			r.escaper.feed(node.Content)
+			if err := r.write(node.Content); err != nil {
+				return err
+			}
+		case ast.TemplateExpr:
+			v, typ, _, err := r.eval(ex, node)
+			if err != nil {
+				return err
+			}
 
-	lastIndex := 0
-	for _, match := range matches {
-		if len(match) < 4 {
-			continue
-		}
+			for _, filter := range node.Filters {
+				v, typ, err = r.filter(ex, filter, v, typ)
+				if err != nil {
+					return err
+				}
+			}
+
+			if err := r.write(r.escaper.escape(v, typ)); err != nil {
+				return err
+			}
+		case ast.TemplateIf:
+			v, typ, expr, err := r.eval(ex, node)
+			if err != nil {
+				return err
+			}
+
+			if typ != ast.VarBool {
+				return exprErr(ErrInvalidTemplate, expr, fmt.Errorf("condition must be a boolean, got %s", typ))
+			}
+
+			branch := node.Else
+			if v.(bool) {
+				branch = node.Children
+			}
+
+			if err := r.render(ex, branch); err != nil {
+				return err
+			}
+		case ast.TemplateFor:
+			v, typ, expr, err := r.eval(ex, node)
+			if err != nil {
+				return err
+			}
+
+			items, err := forInItems(v, typ, len(node.Vars) == 2)
+			if err != nil {
+				return exprErr(ErrInvalidTemplate, expr, err)
+			}
+
+			for _, vars := range items {
+				loopEx := NewExecuter(r.c.runt, ex, r.c.file, r.c.namespace, "for", r.c.uses)
 
-		if match[0] > lastIndex {
-			result = append(result, TemplatePart{
-				Static:  true,
-				Content: s[lastIndex:match[0]],
-			})
+				for i, v := range vars {
+					if err := loopEx.DeclareVariable(node.Vars[i], &variable{Type: toNodeType(v.Type), Value: v.Value}); err != nil {
+						return exprErr(ErrVariable, expr, fmt.Errorf("cannot declare '%s': %w", node.Vars[i], err))
+					}
+				}
+
+				if err := r.render(loopEx, node.Children); err != nil {
+					return err
+				}
+			}
+		case ast.TemplateBlock:
+			// Blocks of an extending template replace the default content
+			if block, ok := r.state.blocks[node.Content]; ok {
+				if err := r.renderBlock(block); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := r.render(ex, node.Children); err != nil {
+				return err
+			}
+		case ast.TemplateComponent:
+			v, typ, err := r.renderComponent(ex, node)
+			if err != nil {
+				return err
+			}
+
+			if err := r.write(r.escaper.escape(v, typ)); err != nil {
+				return err
+			}
 		}
+	}
+
+	return nil
+}
+
+func (r *templateRenderer) write(s string) error {
+	if _, err := io.WriteString(r.out, s); err != nil {
+		return &NodeError{Type: ErrInvalidTemplate, Err: fmt.Errorf("cannot write the template: %w", err), Info: r.info}
+	}
+	return nil
+}
 
-		result = append(result, TemplatePart{
-			Static:  false,
-			Content: strings.TrimSpace(s[match[2]:match[3]]),
-		})
+// renderBlock renders a block of an extending template in the context of the layout
+func (r *templateRenderer) renderBlock(block *templateBlock) error {
+	c := r.c
+	r.c = block.c
+	defer func() { r.c = c }()
 
-		lastIndex = match[1]
+	return r.render(block.ex, block.nodes)
+}
+
+// renderString renders the nodes into a string with a new renderer,
+// like the slots of components
+func (r *templateRenderer) renderString(ex Executer, nodes []ast.TemplateNode) (string, error) {
+	var sb strings.Builder
+
+	sub := &templateRenderer{c: r.c, info: r.info, state: r.state, out: &sb}
+	if err := sub.render(ex, nodes); err != nil {
+		return "", err
+	}
+
+	return sb.String(), nil
+}
+
+// eval evaluates the compiled expression of the node
+func (r *templateRenderer) eval(ex Executer, node ast.TemplateNode) (interface{}, ast.NodeType, ast.Expr, error) {
+	v, typ, err := ex.evalExpr(node.Expr)
+	if err != nil {
+		return nil, ast.VarUnknown, nil, exprErr(ErrInvalidTemplate, node.Expr, err)
+	}
+
+	return v, typ, node.Expr, nil
+}
+
+// filter applies a template filter on the value. The filters registered
+// in the runtime and the built-in ones are used first, then the Smarti
+// functions with the same name.
+func (r *templateRenderer) filter(ex Executer, filter ast.TemplateFilter, v interface{}, typ ast.NodeType) (interface{}, ast.NodeType, error) {
+	vars, err := ex.funcGetArgs(filter.Args)
+	if err != nil {
+		return nil, ast.VarUnknown, err
 	}
 
-	if lastIndex < len(s) {
-		result = append(result, TemplatePart{
-			Static:  true,
-			Content: s[lastIndex:],
-		})
+	value := &variable{Type: typ, Value: v}
+
+	if fn, ok := r.c.runt.filter(filter.Name); ok {
+		ret, err := fn(toPkgVar([]*variable{value})[0], toPkgVar(vars))
+		if err != nil {
+			return nil, ast.VarUnknown, exprErr(ErrInvalidTemplate, filter.Expr, fmt.Errorf("%s filter: %w", filter.Name, err))
+		}
+		return ret.Value, toNodeType(ret.Type), nil
 	}
 
-	return result
+	fn, ok := ex.lookupFunc(filter.Name)
+	if !ok {
+		return nil, ast.VarUnknown, exprErr(ErrInvalidTemplate, filter.Expr, fmt.Errorf("unknown filter '%s'", filter.Name))
+	}
+
+	ret, err := ex.callDecl(fn, append([]*variable{value}, vars...), filter.Expr.Pos())
+	if err != nil {
+		return nil, ast.VarUnknown, err
+	}
+
+	if len(ret) == 0 {
+		return nil, ast.VarNil, nil
+	}
+	return ret[0].Value, toNodeType(ret[0].Type), nil
 }
@@ -0,0 +1,117 @@
+package runtime
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bndrmrtn/smarti/internal/ast"
+	"github.com/bndrmrtn/smarti/internal/lexer"
+	"github.com/bndrmrtn/smarti/internal/packages"
+)
+
+func TestTemplateBlocks(t *testing.T) {
+	expectOutput(t, `
+let users = [
+    {"name": "<John>", "admin": true},
+    {"name": "Jane", "admin": false},
+    {"name": "Joe", "admin": false}
+];
+let title = "Users";
+
+out.write(<>
+<h1>{{ title }}</h1>
+<ul>{{ for i, user in users }}
+    <li class="{{ if user.admin }}admin{{ else }}user{{ end }}">{{ i + 1 }}. {{ user.name }}{{ if i == users.length - 1 }}!{{ end }}</li>{{ end }}
+</ul>
+{{ for key, value in users[0] }}{{ key }}={{ value }};{{ end }}
+{{ if users.length > 5 }}many{{ else if users.length > 2 }}some{{ else }}few{{ end }}
+</>);
+`, `<h1>Users</h1>
+<ul>
+    <li class="admin">1. &lt;John&gt;</li>
+    <li class="user">2. Jane</li>
+    <li class="user">3. Joe!</li>
+</ul>
+name=&lt;John&gt;;admin=true;
+some`)
+}
+
+func TestTemplateBlockErrors(t *testing.T) {
+	tests := map[string]string{
+		`let t = <>{{ if 1 }}x{{ end }}</>;`:               "condition must be a boolean",
+		`let t = <>{{ for x in 5 }}x{{ end }}</>;`:         "cannot iterate over number",
+		`let t = <>{{ for x in [1] }}{{ y }}{{ end }}</>;`: "invalid variable reference",
+		`let t = <>{{ if a }}</>;`:                         "missing {{ end }}",
+	}
+
+	for src, want := range tests {
+		_, err := execSource(t, src)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected error containing %q, got %v", src, want, err)
+		}
+	}
+}
+
+const benchmarkTemplate = `
+let users = [
+    {"name": "<John>", "email": "john@example.com", "admin": true},
+    {"name": "Jane", "email": "jane@example.com", "admin": false},
+    {"name": "Joe", "email": "joe@example.com", "admin": false}
+];
+let page = <>
+<h1>{{ users.length }} users</h1>
+<ul>{{ for i, user in users }}
+    <li class="{{ if user.admin }}admin{{ else }}user{{ end }}">
+        {{ i + 1 }}. <a href="mailto:{{ user.email }}">{{ user.name | upper }}</a>
+    </li>{{ end }}
+</ul>
+</>;
+`
+
+// BenchmarkTemplate compares rendering a template compiled by the parser
+// with compiling it on every render
+func BenchmarkTemplate(b *testing.B) {
+	tokens, err := lexer.Tokenize("bench.smt", benchmarkTemplate)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	ps := ast.NewParser(tokens)
+	if err := ps.Parse(); err != nil {
+		b.Fatal(err)
+	}
+
+	ex, nodes, err := New().Executer("bench.smt", false, nil, "global", make(map[string]packages.Package), ps.Nodes)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	if _, err := ex.Execute(nodes); err != nil {
+		b.Fatal(err)
+	}
+
+	lit := ps.Nodes[len(ps.Nodes)-1].(*ast.VarDecl).Value.(*ast.LiteralExpr)
+
+	b.Run("compiled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := ex.evaluateTemplate(lit); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("compile per render", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			template, err := ast.ParseTemplate(lit.Value, lit.Info)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			if _, err := ex.evaluateTemplate(&ast.LiteralExpr{Type: lit.Type, Value: lit.Value, Info: lit.Info, Template: template}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
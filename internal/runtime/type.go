@@ -18,20 +18,27 @@ type Executer interface {
 	GetVariable(name string) (*variable, error)
 	AccessVariableValue(name string) (*packages.Variable, error)
 	DeclareFunc(name string, fn funcDecl) error
+	DeclareType(name string, t *typeDecl) error
 
 	GetPackages() map[string]packages.Package
 	GetPackage(name string) (packages.Package, error)
 
-	Execute(nodes []ast.Node) ([]*packages.FuncReturn, error)
+	Execute(nodes []ast.Stmt) ([]*packages.FuncReturn, error)
+	execute(nodes []ast.Stmt) ([]*packages.FuncReturn, error)
 
 	// Core methods
 
-	createVariable(node ast.Node, onlyReturnValue ...bool) (interface{}, ast.NodeType, error)
-	callFunc(node ast.Node) ([]*packages.FuncReturn, error)
-	funcGetArgs(nodes []ast.Node) ([]*variable, error)
-	funcGetReturn(nodes []ast.Node) ([]*packages.FuncReturn, error)
-
-	evaluateExpression(node ast.Node) (interface{}, ast.NodeType, error)
-	evaluateTemplate(node ast.Node) (string, error)
+	callFunc(call *ast.CallExpr) ([]*packages.FuncReturn, error)
+	lookupFunc(name string) (funcDecl, bool)
+	lookupType(name string) (*typeDecl, bool)
+	callDecl(fn funcDecl, args []*variable, info ast.NodeFileInfo) ([]*packages.FuncReturn, error)
+	funcGetArgs(args []ast.Expr) ([]*variable, error)
+
+	evalExpr(e ast.Expr) (interface{}, ast.NodeType, error)
+	evaluateTemplate(lit *ast.LiteralExpr) (string, error)
+	evaluateCondition(cond ast.Expr) (bool, error)
+	templateState() *templateState
+	setTemplateState(state *templateState)
+	setImports(chain []string)
 	runtime() *Runtime
 }
@@ -10,6 +10,8 @@ type variable struct {
 	Value interface{}
 	Ref   bool
 	Scope ast.NodeScope
+	// Const variables cannot be assigned after their declaration
+	Const bool
 }
 
 func toPkgVar(v []*variable) []*packages.Variable {
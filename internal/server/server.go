@@ -1,6 +1,7 @@
 package server
 
 import (
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -10,13 +11,12 @@ import (
 	"github.com/bndrmrtn/smarti/internal/lexer"
 	"github.com/bndrmrtn/smarti/internal/packages"
 	"github.com/bndrmrtn/smarti/internal/runtime"
-	"github.com/fatih/color"
 )
 
 type Server struct {
 	dir string
 
-	booster map[string][]ast.Node
+	booster map[string][]ast.Stmt
 }
 
 func New(directory string) (*Server, error) {
@@ -31,12 +31,11 @@ func New(directory string) (*Server, error) {
 
 	return &Server{
 		dir:     directory,
-		booster: make(map[string][]ast.Node),
+		booster: make(map[string][]ast.Stmt),
 	}, nil
 }
 
 func (s *Server) Start(listenAddr string) error {
-	color.NoColor = true
 	return http.ListenAndServe(listenAddr, s)
 }
 
@@ -53,7 +52,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	lx := lexer.New(path)
 	if err := lx.Parse(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.fail(w, r, err)
 		return
 	}
 
@@ -64,7 +63,7 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	parser := ast.NewParser(lx.Tokens)
 	if err := parser.Parse(); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		s.fail(w, r, err)
 		return
 	}
 
@@ -73,15 +72,52 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	s.execute(path, parser.Nodes, w, r)
 }
 
-func (s *Server) execute(file string, nodes []ast.Node, w http.ResponseWriter, r *http.Request) {
+func (s *Server) execute(file string, nodes []ast.Stmt, w http.ResponseWriter, r *http.Request) {
+	rw := &responseWriter{ResponseWriter: w}
 	runt := runtime.New()
 
-	runt.With("response", packages.NewResponse(w))
+	runt.With("response", packages.NewResponse(rw))
 	runt.With("request", packages.NewRequest(r))
 
 	if err := runt.Run(file, nodes); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		if !rw.started {
+			s.fail(w, r, err)
+			return
+		}
+
+		// The status code and a part of the page are already sent,
+		// the connection is closed so the client sees an incomplete response
+		log.Printf("smarti: %s: %s", r.URL.Path, ast.Render(err, false))
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// fail logs the report of an error and sends a 500 response. The report
+// shows the source and the stack trace, so it is not sent to the client.
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("smarti: %s: %s", r.URL.Path, ast.Render(err, false))
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
+
+// responseWriter remembers whether the response has been started.
+// Errors after that cannot change the status code anymore.
+type responseWriter struct {
+	http.ResponseWriter
+	started bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.started = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.started = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
 	}
-	return
 }